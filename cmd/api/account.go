@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/mailer"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+// purgeBatchSize bounds how many accounts one run of the deletion worker erases.
+const purgeBatchSize = 100
+
+type AccountDeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// deleteAccountHandler godoc
+//
+//	@Summary		Deletes the caller's account
+//	@Description	Schedules the account for deletion after the grace period, logs it out everywhere and revokes its API keys. Logging in again before then cancels the deletion.
+//	@Tags			users
+//	@Produce		json
+//	@Success		202	{object}	AccountDeletionResponse
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getPrincipalFromContext(r).User
+	deleteAt := time.Now().Add(app.config.Account.DeletionGrace)
+
+	ctx := r.Context()
+	if err := app.store.Users.ScheduleDeletion(ctx, user.ID, deleteAt); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	// nothing may be served from the cached user while deletion is pending
+	if err := app.cacheStorage.Users.Delete(ctx, user.ID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	vars := struct {
+		Username string
+		DeleteAt string
+	}{
+		Username: user.Username,
+		DeleteAt: deleteAt.UTC().Format("January 2, 2006 15:04 MST"),
+	}
+
+	if err := app.sendMail(mailer.AccountDeletionTemplate, user.Username, user.Email, vars); err != nil {
+		app.logger.Errorw("error sending account deletion email", "error", err)
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusAccepted, AccountDeletionResponse{DeletionScheduledAt: deleteAt}); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// exportAccountHandler godoc
+//
+//	@Summary		Exports the caller's data
+//	@Description	Downloads the profile, posts, comments and follow graph of the caller as a ZIP archive of JSON files, or as a single JSON document with format=json
+//	@Tags			users
+//	@Produce		application/zip
+//	@Produce		json
+//	@Param			format	query		string	false	"zip (default) or json"
+//	@Success		200		{object}	store.UserExport
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [get]
+func (app *application) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "json" {
+		pkg.BadRequestError(w, r, fmt.Errorf("unsupported export format %q", format))
+		return
+	}
+
+	user := getPrincipalFromContext(r).User
+	export, err := app.store.Users.Export(r.Context(), user.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("gophersocial-export-%d-%s", user.ID, export.ExportedAt.UTC().Format("20060102"))
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(export); err != nil {
+			app.logger.Errorw("error writing data export", "error", err)
+		}
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"posts.json", export.Posts},
+		{"comments.json", export.Comments},
+		{"followers.json", export.Followers},
+		{"following.json", export.Following},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+	// headers are sent with the first byte, so from here on errors can only be logged
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			app.logger.Errorw("error writing data export", "error", err)
+			return
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			app.logger.Errorw("error writing data export", "error", err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		app.logger.Errorw("error writing data export", "error", err)
+	}
+}
+
+// runAccountDeletionWorker purges accounts whose grace period has ended, once
+// per configured interval, until ctx is cancelled.
+func (app *application) runAccountDeletionWorker(ctx context.Context) {
+	ticker := time.NewTicker(app.config.Account.DeletionInterval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeDueAccounts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) purgeDueAccounts(ctx context.Context) {
+	ids, err := app.store.Users.GetDueForDeletion(ctx, purgeBatchSize)
+	if err != nil {
+		app.logger.Errorw("error listing accounts due for deletion", "error", err)
+		return
+	}
+
+	for _, id := range ids {
+		err := app.store.Users.Purge(ctx, id)
+		switch err {
+		case nil:
+			app.logger.Infow("account purged", "user_id", id)
+		case store.ErrorNotFound:
+			// deletion was cancelled by a login in the meantime
+		default:
+			app.logger.Errorw("error purging account", "user_id", id, "error", err)
+		}
+	}
+}
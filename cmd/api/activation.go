@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/internal/mailer"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+type ResendActivationPayload struct {
+	Email string `json:"email"`
+}
+
+const resendActivationMessage = "if an inactive account with that email exists, a new activation email has been sent"
+
+// resendActivationHandler godoc
+//
+//	@Summary		Resends the activation email
+//	@Description	Invalidates earlier activation links and mails a new one. The response is the same for unknown, already active and throttled emails.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationPayload	true	"Account email"
+//	@Success		202		{string}	string					"Activation email sent"
+//	@Router			/auth/activation/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	// the lookup and the mail happen after the response, so known and
+	// unknown addresses are answered equally fast
+	ctx := context.WithoutCancel(r.Context())
+	app.background(func() {
+		if err := app.resendActivation(ctx, payload.Email); err != nil {
+			app.logger.Errorw("error resending activation email", "error", err)
+		}
+	})
+
+	if err := pkg.JsonResponse(w, http.StatusAccepted, resendActivationMessage); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) resendActivation(ctx context.Context, email string) error {
+	if !app.allowEmail(email) {
+		app.logger.Infow("activation resend throttled")
+		return nil
+	}
+
+	user, err := app.store.Users.GetInactiveByEmail(ctx, email)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return nil
+		}
+		return err
+	}
+
+	invitation, err := app.store.Tokens.Replace(ctx, user.ID, store.PurposeActivation, app.config.Mail.Exp)
+	if err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.FrontEndURL, invitation.Plaintext),
+	}
+
+	return app.sendMail(mailer.UserWellcomeTemplate, user.Username, user.Email, vars)
+}
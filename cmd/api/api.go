@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/MohammadBohluli/social-app-go/docs"
 	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/internal/config"
 	"github.com/MohammadBohluli/social-app-go/internal/mailer"
 	"github.com/MohammadBohluli/social-app-go/internal/ratelimiter"
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/internal/store/cache"
+	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
@@ -22,63 +27,30 @@ import (
 )
 
 type application struct {
-	config        config
+	config        config.Config
+	db            *sql.DB
 	store         store.Storage
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
 	rateLimiter   ratelimiter.Limiter
-}
 
-type redisConfig struct {
-	host     string
-	port     int
-	password string
-	db       int
-	enabled  bool
-}
-type dbConfig struct {
-	addr         string
-	maxOpenConns int
-	maxIdleConns int
-	maxIdleTime  string
+	emailRateLimiter ratelimiter.Limiter
+	mfaCipher        *auth.Cipher
+	oidcProviders    map[string]*auth.OIDCProvider
+	passwords        pkg.PasswordHasher
+	passwordPolicy   *auth.PasswordPolicy
+	// dummyPasswordHash is verified against when no user matches a login, so
+	// unknown emails take as long as wrong passwords.
+	dummyPasswordHash string
+	// tasks tracks work started by background. It is a pointer since the
+	// routes are registered on a copy of the application.
+	tasks *sync.WaitGroup
 }
 
-type authConfig struct {
-	basic basicConfig
-	token tokenConfig
-}
-
-type tokenConfig struct {
-	secret string
-	exp    time.Duration
-}
-
-type basicConfig struct {
-	username string
-	password string
-}
-type mailConfig struct {
-	exp       time.Duration
-	sendGrid  sendGridConfig
-	fromEmail string
-}
-
-type sendGridConfig struct {
-	apiKey string
-}
-type config struct {
-	addr        string
-	db          dbConfig
-	apiUrl      string
-	mail        mailConfig
-	frontEndURL string
-	evn         string
-	auth        authConfig
-	redisCfg    redisConfig
-	rateLimiter ratelimiter.Config
-}
+// requestTimeout bounds how long any request may run.
+const requestTimeout = 60 * time.Second
 
 func (app application) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
@@ -88,49 +60,147 @@ func (app application) RegisterRoutes() http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(app.RateLimiterMiddleware)
 
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(middleware.Timeout(requestTimeout))
+
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
 
 	r.Route("/v1", func(r chi.Router) {
 
 		r.Get("/health-check", app.healthCheckHandler)
+		r.Route("/ops", app.opsRoutes)
 
 		// swagger
-		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.Addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.RequireScope(auth.ScopePostsWrite)).Post("/", app.createPostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
-				r.Get("/", app.getPostHandler)
-				r.Delete("/", app.checkPostOwnerShip("admin", app.deletePostHandler))
-				r.Patch("/", app.checkPostOwnerShip("moderator", app.updatePostHandler))
+				r.Use(app.postContextMiddleware)
+
+				r.With(app.RequireScope(auth.ScopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.RequireScope(auth.ScopePostsWrite)).Delete("/", app.checkPostOwnerShip(store.PermissionPostsDeleteAny, app.deletePostHandler))
+				r.With(app.RequireScope(auth.ScopePostsWrite)).Patch("/", app.checkPostOwnerShip(store.PermissionPostsUpdateAny, app.updatePostHandler))
+
+				r.Route("/revisions", func(r chi.Router) {
+					r.With(app.RequireScope(auth.ScopePostsRead)).Get("/", app.checkPostOwnerShip(store.PermissionPostsUpdateAny, app.listPostRevisionsHandler))
+					r.With(app.RequireScope(auth.ScopePostsRead)).Get("/{version}/diff", app.checkPostOwnerShip(store.PermissionPostsUpdateAny, app.postRevisionDiffHandler))
+					r.With(app.RequireScope(auth.ScopePostsWrite)).Post("/{version}/restore", app.checkPostOwnerShip(store.PermissionPostsUpdateAny, app.restorePostRevisionHandler))
+				})
+
+				r.Route("/reactions", func(r chi.Router) {
+					r.With(app.RequireScope(auth.ScopePostsRead)).Get("/", app.listPostReactionsHandler)
+					r.With(app.RequireScope(auth.ScopePostsWrite)).Put("/{reaction}", app.addPostReactionHandler)
+					r.With(app.RequireScope(auth.ScopePostsWrite)).Delete("/{reaction}", app.removePostReactionHandler)
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.With(app.RequireScope(auth.ScopeCommentsRead)).Get("/", app.listCommentsHandler)
+					r.With(app.RequireScope(auth.ScopeCommentsRead)).Get("/tree", app.commentTreeHandler)
+					r.With(app.RequireScope(auth.ScopeCommentsWrite)).Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentContextMiddleware)
+
+						r.With(app.RequireScope(auth.ScopeCommentsRead)).Get("/replies", app.commentRepliesHandler)
+						r.With(app.RequireScope(auth.ScopeCommentsWrite)).Patch("/", app.checkCommentOwnership(store.PermissionCommentsUpdateAny, app.updateCommentHandler))
+						r.With(app.RequireScope(auth.ScopeCommentsWrite)).Delete("/", app.checkCommentOwnership(store.PermissionCommentsDeleteAny, app.deleteCommentHandler))
+
+						r.Route("/reactions", func(r chi.Router) {
+							r.With(app.RequireScope(auth.ScopeCommentsRead)).Get("/", app.listCommentReactionsHandler)
+							r.With(app.RequireScope(auth.ScopeCommentsWrite)).Put("/{reaction}", app.addCommentReactionHandler)
+							r.With(app.RequireScope(auth.ScopeCommentsWrite)).Delete("/{reaction}", app.removeCommentReactionHandler)
+						})
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
 
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RequireUserSession)
+
+				r.Route("/mfa", func(r chi.Router) {
+					r.Post("/", app.enrollMFAHandler)
+					r.Delete("/", app.disableMFAHandler)
+					r.Post("/confirm", app.confirmMFAHandler)
+				})
+
+				r.Delete("/", app.deleteAccountHandler)
+				r.Get("/export", app.exportAccountHandler)
+				r.Post("/email", app.changeEmailHandler)
+				r.Put("/password", app.changePasswordHandler)
+
+				r.Route("/sessions", func(r chi.Router) {
+					r.Get("/", app.listSessionsHandler)
+					r.Delete("/", app.revokeOtherSessionsHandler)
+					r.Delete("/{sessionID}", app.revokeSessionHandler)
+				})
+
+				r.Route("/api-keys", func(r chi.Router) {
+					r.Post("/", app.createAPIKeyHandler)
+					r.Get("/", app.listAPIKeysHandler)
+					r.Delete("/{keyID}", app.revokeAPIKeyHandler)
+				})
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.RequireScope(auth.ScopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.RequireScope(auth.ScopeUsersWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.RequireScope(auth.ScopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler)
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RequireScope(auth.ScopeFeedRead))
 				r.Get("/feed", app.getUserFeedHandler)
 
 			})
 		})
 
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.RequireUserSession)
+
+			r.Route("/roles", func(r chi.Router) {
+				r.Use(app.RequirePermission(store.PermissionRolesManage))
+				r.Get("/", app.listRolesHandler)
+				r.Post("/", app.createRoleHandler)
+				r.Patch("/{roleID}", app.updateRoleHandler)
+			})
+			r.With(app.RequirePermission(store.PermissionRolesManage)).Get("/permissions", app.listPermissionsHandler)
+			r.With(app.RequirePermission(store.PermissionUsersRoleUpdate)).Put("/users/{userID}/role", app.updateUserRoleHandler)
+		})
+
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.With(app.AuthTokenMiddleware, app.RequireUserSession).Post("/logout", app.logoutHandler)
+
+			r.Post("/activation/resend", app.resendActivationHandler)
+			r.Post("/mfa/verify", app.verifyMFAHandler)
+			r.Post("/magic-link", app.requestMagicLinkHandler)
+			r.Post("/magic-link/consume", app.consumeMagicLinkHandler)
+
+			r.Route("/oidc/{provider}", func(r chi.Router) {
+				r.Get("/start", app.oidcStartHandler)
+				r.Get("/callback", app.oidcCallbackHandler)
+			})
+
+			r.Route("/password", func(r chi.Router) {
+				r.Post("/forgot", app.forgotPasswordHandler)
+				r.Post("/reset", app.resetPasswordHandler)
+			})
 
 		})
 	})
@@ -142,11 +212,11 @@ func (app *application) start(mux http.Handler) error {
 
 	// documents swagger
 	docs.SwaggerInfo.Version = version
-	docs.SwaggerInfo.Host = app.config.apiUrl
+	docs.SwaggerInfo.Host = app.config.APIURL
 	docs.SwaggerInfo.BasePath = "/v1"
 
 	server := http.Server{
-		Addr:         app.config.addr,
+		Addr:         app.config.Addr,
 		Handler:      mux,
 		WriteTimeout: 30 * time.Second,
 		ReadTimeout:  10 * time.Second,
@@ -169,5 +239,29 @@ func (app *application) start(mux http.Handler) error {
 
 	app.logger.Infof("✅ Starting server on http://localhost%s", server.Addr)
 
-	return http.ListenAndServe(server.Addr, server.Handler)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err := <-shutdown
+	app.tasks.Wait()
+
+	return err
+}
+
+// background runs fn without holding up the response, so how long fn takes
+// cannot be read from the response time. start waits for it on shutdown.
+func (app *application) background(fn func()) {
+	app.tasks.Add(1)
+
+	go func() {
+		defer app.tasks.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Errorw("background task panicked", "error", err)
+			}
+		}()
+
+		fn()
+	}()
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateAPIKeyPayload struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is a Go duration such as "720h". Empty means the key never expires.
+	ExpiresIn string `json:"expires_in"`
+}
+
+type APIKeyWithSecret struct {
+	*store.APIKey
+	Key string `json:"key"`
+}
+
+// createAPIKeyHandler godoc
+//
+//	@Summary		Creates an API key
+//	@Description	Creates a personal API key. The key is returned only once; send it as "Authorization: ApiKey <key>".
+//	@Tags			api-keys
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAPIKeyPayload	true	"Key name, scopes and lifetime"
+//	@Success		201		{object}	APIKeyWithSecret
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys [post]
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPIKeyPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	if payload.Name == "" {
+		pkg.BadRequestError(w, r, errors.New("name is required"))
+		return
+	}
+
+	if len(payload.Scopes) == 0 {
+		pkg.BadRequestError(w, r, errors.New("at least one scope is required"))
+		return
+	}
+
+	for _, scope := range payload.Scopes {
+		if !auth.IsAPIKeyScope(scope) {
+			pkg.BadRequestError(w, r, fmt.Errorf("unknown scope %q", scope))
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if payload.ExpiresIn != "" {
+		d, err := time.ParseDuration(payload.ExpiresIn)
+		if err != nil || d <= 0 {
+			pkg.BadRequestError(w, r, errors.New("expires_in must be a positive duration"))
+			return
+		}
+
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	apiKey := &store.APIKey{
+		UserID:    getPrincipalFromContext(r).User.ID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		Scopes:    payload.Scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := app.store.APIKeys.Create(r.Context(), apiKey, hash); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, APIKeyWithSecret{APIKey: apiKey, Key: key}); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// listAPIKeysHandler godoc
+//
+//	@Summary		Lists API keys
+//	@Description	Lists the caller's API keys, including revoked and expired ones
+//	@Tags			api-keys
+//	@Produce		json
+//	@Success		200	{array}	store.APIKey
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys [get]
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.store.APIKeys.GetByUserID(r.Context(), getPrincipalFromContext(r).User.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, keys); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// revokeAPIKeyHandler godoc
+//
+//	@Summary		Revokes an API key
+//	@Tags			api-keys
+//	@Param			keyID	path		int		true	"API key ID"
+//	@Success		204		{string}	string	"API key revoked"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/api-keys/{keyID} [delete]
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	err = app.store.APIKeys.Revoke(r.Context(), getPrincipalFromContext(r).User.ID, types.ID(keyID))
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
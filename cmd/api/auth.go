@@ -1,17 +1,20 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
 	"github.com/MohammadBohluli/social-app-go/internal/mailer"
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 )
 
 type RegisterUserRequest struct {
@@ -25,6 +28,22 @@ type UserWithActivateToken struct {
 	Token string `json:"token"`
 }
 
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	errAccountLocked      = errors.New("account is temporarily locked after too many failed attempts")
+)
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
 type CreateUserTokenPayload struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -39,6 +58,7 @@ type CreateUserTokenPayload struct {
 //	@Produce		json
 //	@Param			payload	body		RegisterUserRequest		true	"User credentials"
 //	@Success		201		{object}	UserWithActivateToken	"User registered"
+//	@Failure		422		{object}	error
 //	@Router			/auth/user [post]
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload RegisterUserRequest
@@ -47,7 +67,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	hashPassword, err := pkg.Hash(payload.Password)
+	fields := map[string][]string{}
+	if strings.TrimSpace(payload.Username) == "" {
+		fields["username"] = []string{"is required"}
+	}
+	if addr, err := mail.ParseAddress(payload.Email); err != nil || addr.Address != payload.Email {
+		fields["email"] = []string{"must be a valid email address"}
+	}
+	app.checkPassword(fields, "password", payload.Password, payload.Username, payload.Email)
+
+	if len(fields) > 0 {
+		pkg.FailedValidationResponse(w, r, fields)
+		return
+	}
+
+	hashPassword, err := app.passwords.Hash(payload.Password)
 	if err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
@@ -62,12 +96,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		},
 	}
 
-	palinToken := uuid.New().String()
-	hash := sha256.Sum256([]byte(palinToken))
-	hashToken := hex.EncodeToString(hash[:])
-
 	ctx := r.Context()
-	err = app.store.Users.CreateAndInvite(ctx, &user, hashToken, app.config.mail.exp)
+	invitation, err := app.store.Users.CreateAndInvite(ctx, &user, app.config.Mail.Exp)
 	if err != nil {
 
 		switch err {
@@ -84,10 +114,10 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	u := UserWithActivateToken{
 		User:  &user,
-		Token: palinToken,
+		Token: invitation.Plaintext,
 	}
 
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontEndURL, hashToken)
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.FrontEndURL, invitation.Plaintext)
 	vars := struct {
 		Username      string
 		ActivationURL string
@@ -96,10 +126,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		ActivationURL: activationURL,
 	}
 
-	isProdEnv := app.config.evn == "development"
-	status, err := app.mailer.Send(mailer.UserWellcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-
-	if err != nil {
+	if err := app.sendMail(mailer.UserWellcomeTemplate, user.Username, user.Email, vars); err != nil {
 		app.logger.Errorw("error sending wellcome email", "error", err)
 
 		// roleback user creation if email fails(SAGA pattern)
@@ -112,8 +139,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	app.logger.Infow("Email sent", "status code", status)
-
 	if err := pkg.JsonResponse(w, http.StatusCreated, u); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
@@ -128,7 +153,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 // @Accept			json
 // @Produce		json
 // @Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-// @Success		200		{string}	string					"Token"
+// @Success		201		{object}	TokenResponse			"Access and refresh token"
+// @Success		200		{object}	MFAChallengeResponse	"Two-factor code required"
 // @Router			/auth/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -139,35 +165,287 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	// fetch the user(check if suer exist) from the payload
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			// spend the same time as a real check so unknown emails can't be told apart
+			_, _ = app.passwords.Verify(app.dummyPasswordHash, payload.Password)
+			pkg.UnAuthorizedErrorResponse(w, r, errInvalidCredentials)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsLocked() {
+		// take as long as an unknown email; the real hash is not checked, as
+		// its outcome would still leak whether the password is right
+		_, _ = app.passwords.Verify(app.dummyPasswordHash, payload.Password)
+		pkg.UnAuthorizedErrorResponse(w, r, fmt.Errorf("account %d is locked until %s", user.ID, user.LockedUntil))
+		return
+	}
+
+	// check the password
+	needsRehash, err := app.passwords.Verify(user.Password, payload.Password)
+	if err != nil {
+		if err != pkg.ErrMismatchedPassword {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		lockout := app.config.Auth.Lockout
+		if err := app.store.Users.RecordFailedLogin(ctx, user.ID, lockout.MaxAttempts, lockout.Duration); err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		pkg.UnAuthorizedErrorResponse(w, r, errInvalidCredentials)
+		return
+	}
+
+	if needsRehash {
+		app.rehashPassword(ctx, user.ID, payload.Password)
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := app.store.Users.ResetFailedLogins(ctx, user.ID); err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	app.completeLogin(w, r, user)
+}
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new access and refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		201		{object}	TokenResponse
+//	@Failure		401		{object}	error
+//	@Router			/auth/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	plain, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	refreshToken, err := app.store.RefreshTokens.Rotate(ctx, auth.HashOpaqueToken(payload.RefreshToken), hash, app.config.Auth.Token.RefreshExp)
 	if err != nil {
 		switch err {
 		case store.ErrorNotFound:
-			pkg.UnAuthorizedBasicErrorResponse(w, r, err)
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		case store.ErrRefreshTokenReused:
+			app.logger.Warnw("refresh token reuse detected, token family revoked")
+			pkg.UnAuthorizedErrorResponse(w, r, err)
 		default:
 			pkg.InternalServerError(w, r, err)
 		}
 		return
 	}
-	// generate the token -> add claims
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": "gopherSocial",
+
+	user, err := app.store.Users.GetByID(ctx, refreshToken.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
+	accessToken, err := app.generateAccessToken(user, refreshToken.FamilyID)
 	if err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
-	// send it to the client
 
-	if err := pkg.JsonResponse(w, http.StatusCreated, token); err != nil {
+	tokens := TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plain,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.Auth.Token.Exp.Seconds()),
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, tokens); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
 }
+
+// logoutHandler godoc
+//
+//	@Summary		Logs out
+//	@Description	Ends the session of the access token used for the request and revokes its refresh tokens
+//	@Tags			authentication
+//	@Success		204	{string}	string	"Logged out"
+//	@Security		ApiKeyAuth
+//	@Router			/auth/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal := getPrincipalFromContext(r)
+	claims := principal.Claims
+
+	ctx := r.Context()
+	err := app.store.Sessions.Revoke(ctx, principal.User.ID, claims.SessionID)
+	if err != nil && err != store.ErrorNotFound {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.cacheStorage.Tokens.Deny(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeLogin finishes a login once user has proven their first factor. With
+// two-factor login enabled it answers with an mfa challenge, otherwise it
+// starts a session and returns its tokens.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User) {
+	ctx := r.Context()
+
+	// with two-factor login the first factor only buys a short lived mfa token
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil && err != store.ErrorNotFound {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if mfa != nil && mfa.IsEnabled() {
+		mfaToken, err := app.generateMFAToken(user)
+		if err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		challenge := MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresIn:   int64(app.config.Auth.MFA.PendingExp.Seconds()),
+		}
+
+		if err := pkg.JsonResponse(w, http.StatusOK, challenge); err != nil {
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	// generate the tokens and send them to the client
+	tokens, err := app.issueTokens(ctx, user, newSession(r, user))
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, tokens); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// issueTokens starts session for user and returns its first access and
+// refresh token. It also cancels a pending deletion of the account.
+func (app *application) issueTokens(ctx context.Context, user *store.User, session *store.Session) (*TokenResponse, error) {
+	// logging in is how a scheduled account deletion is called off
+	cancelled, err := app.store.Users.CancelDeletion(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cancelled {
+		app.logger.Infow("account deletion cancelled by login", "user_id", user.ID)
+	}
+
+	plain, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &store.RefreshToken{Expiry: time.Now().Add(app.config.Auth.Token.RefreshExp)}
+	if err := app.store.Sessions.Create(ctx, session, refreshToken, hash); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := app.generateAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plain,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.Auth.Token.Exp.Seconds()),
+	}, nil
+}
+
+func (app *application) generateAccessToken(user *store.User, sessionID string) (string, error) {
+	now := time.Now()
+	claims := auth.NewClaims(user.ID, user.Role.Name)
+	claims.SessionID = sessionID
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(app.config.Auth.Token.Exp))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// verifyCurrentPassword re-checks the password of a logged in user before a
+// sensitive change. Wrong passwords count towards the same lockout as failed
+// logins, so an access token alone is no oracle for guessing the password. It
+// returns errAccountLocked while the account is locked and
+// pkg.ErrMismatchedPassword for a wrong password.
+func (app *application) verifyCurrentPassword(ctx context.Context, user *store.User, password string) error {
+	if user.IsLocked() {
+		return errAccountLocked
+	}
+
+	if _, err := app.passwords.Verify(user.Password, password); err != nil {
+		if err != pkg.ErrMismatchedPassword {
+			return err
+		}
+
+		lockout := app.config.Auth.Lockout
+		if err := app.store.Users.RecordFailedLogin(ctx, user.ID, lockout.MaxAttempts, lockout.Duration); err != nil {
+			return err
+		}
+
+		return pkg.ErrMismatchedPassword
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		return app.store.Users.ResetFailedLogins(ctx, user.ID)
+	}
+
+	return nil
+}
+
+// rehashPassword upgrades a hash made with an older algorithm or parameters.
+// The login has already succeeded, so failures are only logged.
+func (app *application) rehashPassword(ctx context.Context, userID types.ID, password string) {
+	hash, err := app.passwords.Hash(password)
+	if err != nil {
+		app.logger.Errorw("error rehashing password", "user_id", userID, "error", err)
+		return
+	}
+
+	if err := app.store.Users.UpdatePassword(ctx, userID, hash); err != nil {
+		app.logger.Errorw("error rehashing password", "user_id", userID, "error", err)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+const (
+	// maxCommentLength bounds comment content, counted in characters.
+	maxCommentLength = 1000
+	// maxCommentDepth is the deepest a reply may be nested; top-level
+	// comments have depth 0.
+	maxCommentDepth = 5
+	// maxTreeReplies bounds the replies shown per comment in a tree.
+	maxTreeReplies = 20
+)
+
+// defaultCommentTree is the first page of a comment tree when no query
+// parameters are given. getPostHandler embeds it in the post.
+var defaultCommentTree = store.CommentTreeQuery{Limit: 20, Replies: 3}
+
+type CreateCommentRequest struct {
+	Content  string    `json:"content"`
+	ParentID *types.ID `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content"`
+}
+
+// createCommentHandler godoc
+//
+//	@Summary		Comments on a post
+//	@Description	Adds a top-level comment, or a reply to the comment given by parent_id
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentRequest	true	"Comment"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentRequest
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	content, err := validateCommentContent(payload.Content)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	post := getPostFromContext(r)
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *payload.ParentID)
+		if err != nil {
+			switch err {
+			case store.ErrorNotFound:
+				pkg.BadRequestError(w, r, errors.New("parent comment does not exist"))
+			default:
+				pkg.InternalServerError(w, r, err)
+			}
+			return
+		}
+
+		switch {
+		case parent.PostID != post.ID:
+			pkg.BadRequestError(w, r, errors.New("parent comment does not exist"))
+			return
+		case parent.Deleted:
+			pkg.BadRequestError(w, r, errors.New("cannot reply to a deleted comment"))
+			return
+		case parent.Depth >= maxCommentDepth:
+			pkg.BadRequestError(w, r, fmt.Errorf("replies can be nested at most %d levels deep", maxCommentDepth))
+			return
+		}
+	}
+
+	user := getPrincipalFromContext(r).User
+	comment := &store.Comment{
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		UserID:   user.ID,
+		Content:  content,
+		User: store.User{
+			ID:       user.ID,
+			Username: user.Username,
+		},
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	comment.Reactions = store.ReactionSummary{Counts: map[string]int{}, Viewer: []string{}}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, comment); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// listCommentsHandler godoc
+//
+//	@Summary		Lists the comments on a post
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Page size, 1 to 100"	default(20)
+//	@Param			offset	query		int		false	"Comments to skip"		default(0)
+//	@Param			sort	query		string	false	"asc (oldest first) or desc"
+//	@Success		200		{array}		store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	paginate := pkg.PaginationQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "asc",
+	}
+
+	p, err := paginate.Parse(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	comments, err := app.store.Comments.ListByPostID(r.Context(), getPostFromContext(r).ID, p)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	page := make([]*store.Comment, len(comments))
+	for i := range comments {
+		page[i] = &comments[i]
+	}
+	if err := app.attachCommentReactions(r.Context(), getPrincipalFromContext(r).User.ID, page...); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, comments); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// updateCommentHandler godoc
+//
+//	@Summary		Edits a comment
+//	@Description	Only the author, or a role allowed to edit any comment, may edit it
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			payload		body		UpdateCommentRequest	true	"New content"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommentRequest
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	content, err := validateCommentContent(payload.Content)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	comment := getCommentFromContext(r)
+	if comment.Deleted {
+		pkg.NotFoundError(w, r, store.ErrorNotFound)
+		return
+	}
+	comment.Content = content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.attachCommentReactions(r.Context(), getPrincipalFromContext(r).User.ID, comment); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, comment); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteCommentHandler godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Only the author, or a role allowed to delete any comment, may delete it. A comment with replies is replaced by a "[deleted]" placeholder.
+//	@Tags			comments
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Success		204			{string}	string	"Comment deleted"
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	if comment.Deleted {
+		pkg.NotFoundError(w, r, store.ErrorNotFound)
+		return
+	}
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentTreeHandler godoc
+//
+//	@Summary		Lists the comments on a post as a tree
+//	@Description	Pages through the top-level comments, each with up to "replies" replies on every level below. reply_count tells which branches continue at /comments/{commentID}/replies.
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Param			limit	query		int	false	"Top-level comments per page, 1 to 100"	default(20)
+//	@Param			offset	query		int	false	"Top-level comments to skip"				default(0)
+//	@Param			replies	query		int	false	"Replies shown per comment, 0 to 20"		default(3)
+//	@Success		200		{array}		store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/tree [get]
+func (app *application) commentTreeHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeCommentTree(w, r, nil)
+}
+
+// commentRepliesHandler godoc
+//
+//	@Summary		Lists the replies to a comment as a tree
+//	@Description	Continues a branch of the comment tree below the given comment, paged like the tree itself
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Param			limit		query		int	false	"Direct replies per page, 1 to 100"	default(20)
+//	@Param			offset		query		int	false	"Direct replies to skip"				default(0)
+//	@Param			replies		query		int	false	"Replies shown per reply, 0 to 20"	default(3)
+//	@Success		200			{array}		store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/replies [get]
+func (app *application) commentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeCommentTree(w, r, &getCommentFromContext(r).ID)
+}
+
+func (app *application) writeCommentTree(w http.ResponseWriter, r *http.Request, parentID *types.ID) {
+	paginate := pkg.PaginationQuery{
+		Limit:  defaultCommentTree.Limit,
+		Offset: defaultCommentTree.Offset,
+	}
+
+	p, err := paginate.Parse(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	q := store.CommentTreeQuery{
+		Limit:   p.Limit,
+		Offset:  p.Offset,
+		Replies: defaultCommentTree.Replies,
+	}
+	if replies := r.URL.Query().Get("replies"); replies != "" {
+		n, err := strconv.Atoi(replies)
+		if err != nil || n < 0 || n > maxTreeReplies {
+			pkg.BadRequestError(w, r, fmt.Errorf("replies must be a number between 0 and %d", maxTreeReplies))
+			return
+		}
+		q.Replies = n
+	}
+
+	tree, err := app.store.Comments.GetTree(r.Context(), getPostFromContext(r).ID, parentID, q)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.attachCommentReactions(r.Context(), getPrincipalFromContext(r).User.ID, tree...); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, tree); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// commentContextMiddleware loads the comment named by the commentID URL
+// parameter. Comments of another post than the one in the URL are not found.
+func (app *application) commentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			pkg.BadRequestError(w, r, err)
+			return
+		}
+
+		comment, err := app.store.Comments.GetByID(ctx, types.ID(id))
+		if err != nil {
+			switch err {
+			case store.ErrorNotFound:
+				pkg.NotFoundError(w, r, err)
+			default:
+				pkg.InternalServerError(w, r, err)
+			}
+			return
+		}
+
+		if comment.PostID != getPostFromContext(r).ID {
+			pkg.NotFoundError(w, r, store.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
+
+func validateCommentContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errors.New("content is required")
+	}
+	if len([]rune(content)) > maxCommentLength {
+		return "", errors.New("content must be at most 1000 characters long")
+	}
+
+	return content, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/MohammadBohluli/social-app-go/internal/mailer"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// changeEmailHandler godoc
+//
+//	@Summary		Requests an email change
+//	@Description	Mails a confirmation link to the new address and a notice to the current one. The email only changes once the link is confirmed.
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body		ChangeEmailPayload	true	"New email and current password"
+//	@Success		202		{string}	string				"Confirmation link sent"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [post]
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	email := strings.TrimSpace(payload.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		pkg.BadRequestError(w, r, errors.New("email is not a valid address"))
+		return
+	}
+
+	ctx := r.Context()
+
+	// the cached user carries no password hash
+	user, err := app.store.Users.GetByID(ctx, getPrincipalFromContext(r).User.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.verifyCurrentPassword(ctx, user, payload.Password); err != nil {
+		switch err {
+		case errAccountLocked:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		case pkg.ErrMismatchedPassword:
+			pkg.UnAuthorizedErrorResponse(w, r, errInvalidCredentials)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if strings.EqualFold(email, user.Email) {
+		pkg.BadRequestError(w, r, errors.New("email is already the account's email"))
+		return
+	}
+
+	if !app.allowEmail(email) {
+		pkg.RateLimitExceededErrorResponse(w, r, app.config.EmailRateLimiter.TimeFrame.String())
+		return
+	}
+
+	token, err := app.store.Users.RequestEmailChange(ctx, user.ID, email, app.config.Mail.EmailChangeExp)
+	if err != nil {
+		switch err {
+		case store.ErrDuplicateEmail:
+			pkg.BadRequestError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	confirm := struct {
+		Username   string
+		NewEmail   string
+		ConfirmURL string
+		ExpiresIn  string
+	}{
+		Username:   user.Username,
+		NewEmail:   email,
+		ConfirmURL: fmt.Sprintf("%s/confirm-email/%s", app.config.FrontEndURL, token.Plaintext),
+		ExpiresIn:  app.config.Mail.EmailChangeExp.String(),
+	}
+
+	if err := app.sendMail(mailer.EmailChangeTemplate, user.Username, email, confirm); err != nil {
+		app.logger.Errorw("error sending email change confirmation", "error", err)
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	notice := struct {
+		Username string
+		NewEmail string
+	}{
+		Username: user.Username,
+		NewEmail: email,
+	}
+
+	if err := app.sendMail(mailer.EmailChangeNoticeTemplate, user.Username, user.Email, notice); err != nil {
+		// the change itself still needs the confirmation, so don't fail the request
+		app.logger.Errorw("error sending email change notice", "error", err)
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusAccepted, "a confirmation link has been sent to the new email"); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// confirmEmailChangeHandler godoc
+//
+//	@Summary		Confirms an email change
+//	@Description	Redeems the link sent to the new address and makes it the account's email
+//	@Tags			users
+//	@Param			token	path		string	true	"Email change token"
+//	@Success		204		{string}	string	"Email changed"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.store.Users.ConfirmEmailChange(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		case store.ErrDuplicateEmail:
+			pkg.BadRequestError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("email changed", "user_id", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
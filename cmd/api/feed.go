@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/MohammadBohluli/social-app-go/types"
 )
@@ -28,6 +29,15 @@ func (app application) getUserFeedHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+	if err := app.attachPostReactions(ctx, getPrincipalFromContext(r).User.ID, posts...); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
 	if err := pkg.JsonResponse(w, http.StatusOK, feed); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+// JWKS godoc
+//
+//	@Summary		Public signing keys
+//	@Description	Serves the keys that verify access tokens as a JSON Web Key Set
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKS
+//	@Failure		404	{object}	error	"Tokens are signed with a shared secret"
+//	@Router			/.well-known/jwks.json [get]
+func (app application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.authenticator.(auth.KeySetProvider)
+	if !ok {
+		pkg.NotFoundError(w, r, errors.New("authenticator does not publish keys"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := pkg.WriteJson(w, http.StatusOK, provider.JWKS()); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
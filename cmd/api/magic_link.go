@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/internal/mailer"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+type MagicLinkPayload struct {
+	Email string `json:"email"`
+}
+
+type ConsumeMagicLinkPayload struct {
+	Token string `json:"token"`
+}
+
+const magicLinkMessage = "if an active account with that email exists, a login link has been sent"
+
+// requestMagicLinkHandler godoc
+//
+//	@Summary		Requests a login link
+//	@Description	Emails a single-use login link. The response is the same for unknown, inactive and throttled emails.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MagicLinkPayload	true	"Account email"
+//	@Success		202		{string}	string				"Login link sent"
+//	@Router			/auth/magic-link [post]
+func (app *application) requestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MagicLinkPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	// done after responding, as a slower answer would give away that the
+	// account exists
+	ctx := context.WithoutCancel(r.Context())
+	app.background(func() {
+		if err := app.sendMagicLink(ctx, payload.Email); err != nil {
+			app.logger.Errorw("error sending magic link", "error", err)
+		}
+	})
+
+	if err := pkg.JsonResponse(w, http.StatusAccepted, magicLinkMessage); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// consumeMagicLinkHandler godoc
+//
+//	@Summary		Logs in with a login link
+//	@Description	Exchanges the token from a login link for an access and refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ConsumeMagicLinkPayload	true	"Token from the login link"
+//	@Success		201		{object}	TokenResponse			"Access and refresh token"
+//	@Success		200		{object}	MFAChallengeResponse	"Two-factor code required"
+//	@Failure		401		{object}	error
+//	@Router			/auth/magic-link/consume [post]
+func (app *application) consumeMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ConsumeMagicLinkPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := app.store.Tokens.Consume(ctx, payload.Token, store.PurposeMagicLink)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.UnAuthorizedErrorResponse(w, r, errors.New("login link is invalid or has expired"))
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsActive {
+		pkg.UnAuthorizedErrorResponse(w, r, errors.New("account is not active"))
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+func (app *application) sendMagicLink(ctx context.Context, email string) error {
+	if !app.allowEmail(email) {
+		app.logger.Infow("magic link throttled")
+		return nil
+	}
+
+	// GetByEmail only finds active users
+	user, err := app.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return nil
+		}
+		return err
+	}
+
+	token, err := app.store.Tokens.Replace(ctx, user.ID, store.PurposeMagicLink, app.config.Mail.MagicLinkExp)
+	if err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username  string
+		LoginURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		LoginURL:  fmt.Sprintf("%s/magic-link/%s", app.config.FrontEndURL, token.Plaintext),
+		ExpiresIn: app.config.Mail.MagicLinkExp.String(),
+	}
+
+	return app.sendMail(mailer.MagicLinkTemplate, user.Username, user.Email, vars)
+}
@@ -0,0 +1,15 @@
+package main
+
+// sendMail renders templateFile with data and mails it to email. Outside of
+// production-like environments the mail goes to the SendGrid sandbox.
+func (app *application) sendMail(templateFile, username, email string, data any) error {
+	isSandbox := app.config.IsDevelopment()
+
+	status, err := app.mailer.Send(templateFile, username, email, data, isSandbox)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Infow("Email sent", "template", templateFile, "status code", status)
+	return nil
+}
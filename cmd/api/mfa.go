@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const recoveryCodesCount = 10
+
+var errInvalidMFACode = errors.New("invalid two-factor code")
+
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFACodePayload struct {
+	Code string `json:"code"`
+}
+
+type DisableMFAPayload struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type VerifyMFAPayload struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// enrollMFAHandler godoc
+//
+//	@Summary		Starts TOTP enrollment
+//	@Description	Generates a TOTP secret. Two-factor login is only enabled once a code from it is confirmed.
+//	@Tags			mfa
+//	@Produce		json
+//	@Success		201	{object}	MFAEnrollmentResponse
+//	@Failure		409	{object}	error	"Two-factor authentication is already enabled"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa [post]
+func (app *application) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := getPrincipalFromContext(r).User
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	encrypted, err := app.mfaCipher.Seal([]byte(secret))
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.Enroll(r.Context(), user.ID, encrypted); err != nil {
+		switch err {
+		case store.ErrorConflict:
+			pkg.ConflictErrorResponse(w, r, errors.New("two-factor authentication is already enabled"))
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	resp := MFAEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(app.config.Auth.MFA.Issuer, user.Email, secret),
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, resp); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// confirmMFAHandler godoc
+//
+//	@Summary		Confirms TOTP enrollment
+//	@Description	Enables two-factor login after a valid code and returns recovery codes. They are shown only once.
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"Code from the authenticator app"
+//	@Success		200		{object}	MFARecoveryCodesResponse
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/confirm [post]
+func (app *application) confirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	user := getPrincipalFromContext(r).User
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.BadRequestError(w, r, errors.New("two-factor enrollment has not been started"))
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mfa.IsEnabled() {
+		pkg.ConflictErrorResponse(w, r, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := app.mfaCipher.Open(mfa.Secret)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(string(secret), payload.Code, time.Now())
+	if !ok {
+		pkg.BadRequestError(w, r, errInvalidMFACode)
+		return
+	}
+
+	codes, err := auth.NewRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashOpaqueToken(code)
+	}
+
+	if err := app.store.MFA.Confirm(ctx, user.ID, step, hashes); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, MFARecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// disableMFAHandler godoc
+//
+//	@Summary		Disables two-factor login
+//	@Description	Turns TOTP off after a valid code and the current password, and drops the recovery codes. Wrong codes and passwords count towards the account lockout.
+//	@Tags			mfa
+//	@Accept			json
+//	@Param			payload	body		DisableMFAPayload	true	"Current password and code from the authenticator app"
+//	@Success		204		{string}	string				"Two-factor login disabled"
+//	@Failure		400		{object}	error				"Invalid two-factor code"
+//	@Failure		401		{object}	error				"Wrong password or account locked"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa [delete]
+func (app *application) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DisableMFAPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// the cached user carries no password hash
+	user, err := app.store.Users.GetByID(ctx, getPrincipalFromContext(r).User.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if user.IsLocked() {
+		pkg.UnAuthorizedErrorResponse(w, r, errAccountLocked)
+		return
+	}
+
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the code is checked before the password, as a right password resets
+	// the failures a wrong code records
+	ok, err := app.verifySecondFactor(ctx, mfa, payload.Code, "")
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		lockout := app.config.Auth.Lockout
+		if err := app.store.Users.RecordFailedLogin(ctx, user.ID, lockout.MaxAttempts, lockout.Duration); err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		pkg.BadRequestError(w, r, errInvalidMFACode)
+		return
+	}
+
+	if err := app.verifyCurrentPassword(ctx, user, payload.Password); err != nil {
+		switch err {
+		case errAccountLocked:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		case pkg.ErrMismatchedPassword:
+			pkg.UnAuthorizedErrorResponse(w, r, errInvalidCredentials)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.MFA.Disable(ctx, user.ID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyMFAHandler godoc
+//
+//	@Summary		Completes a two-factor login
+//	@Description	Exchanges the mfa_token from /auth/token and a TOTP or recovery code for an access and refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		VerifyMFAPayload	true	"MFA token and code"
+//	@Success		201		{object}	TokenResponse
+//	@Failure		401		{object}	error
+//	@Router			/auth/mfa/verify [post]
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFAPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	claims, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		pkg.UnAuthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if !claims.HasScope(auth.ScopeMFAPending) {
+		pkg.UnAuthorizedErrorResponse(w, r, errors.New("not an mfa token"))
+		return
+	}
+
+	ctx := r.Context()
+	denied, err := app.cacheStorage.Tokens.IsDenied(ctx, claims.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if denied {
+		pkg.UnAuthorizedErrorResponse(w, r, errors.New("mfa token has already been used"))
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		pkg.UnAuthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsLocked() {
+		pkg.UnAuthorizedErrorResponse(w, r, fmt.Errorf("account %d is locked until %s", user.ID, user.LockedUntil))
+		return
+	}
+
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, mfa, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		lockout := app.config.Auth.Lockout
+		if err := app.store.Users.RecordFailedLogin(ctx, user.ID, lockout.MaxAttempts, lockout.Duration); err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		// too many wrong codes use the token up, so guessing needs new logins
+		ttl := time.Until(claims.ExpiresAt.Time)
+		failures, err := app.cacheStorage.Tokens.CountFailure(ctx, claims.ID, ttl)
+		if err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+		if failures >= int64(app.config.Auth.MFA.MaxAttempts) {
+			if err := app.cacheStorage.Tokens.Deny(ctx, claims.ID, ttl); err != nil {
+				pkg.InternalServerError(w, r, err)
+				return
+			}
+		}
+
+		pkg.UnAuthorizedErrorResponse(w, r, errInvalidMFACode)
+		return
+	}
+
+	// the mfa token is single use
+	if err := app.cacheStorage.Tokens.Deny(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.issueTokens(ctx, user, newSession(r, user))
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, tokens); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// verifySecondFactor checks a recovery code when one is given and a TOTP code
+// otherwise. Both are single use.
+func (app *application) verifySecondFactor(ctx context.Context, mfa *store.MFA, code, recoveryCode string) (bool, error) {
+	if !mfa.IsEnabled() {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		hash := auth.HashOpaqueToken(auth.NormalizeRecoveryCode(recoveryCode))
+		err := app.store.MFA.UseRecoveryCode(ctx, mfa.UserID, hash)
+		switch err {
+		case nil:
+			return true, nil
+		case store.ErrorNotFound:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	secret, err := app.mfaCipher.Open(mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	err = app.store.MFA.UseStep(ctx, mfa.UserID, step)
+	switch err {
+	case nil:
+		return true, nil
+	case store.ErrorConflict:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// generateMFAToken signs the short lived token that stands in for a login
+// until the second factor is checked.
+func (app *application) generateMFAToken(user *store.User) (string, error) {
+	now := time.Now()
+	claims := auth.NewClaims(user.ID, user.Role.Name)
+	claims.Scopes = []string{auth.ScopeMFAPending}
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(app.config.Auth.MFA.PendingExp))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+
+	return app.authenticator.GenerateToken(claims)
+}
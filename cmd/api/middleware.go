@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/MohammadBohluli/social-app-go/types"
-	"github.com/golang-jwt/jwt/v5"
 )
 
+// errUnauthenticated marks credential failures, as opposed to errors while
+// checking the credentials.
+var errUnauthenticated = errors.New("unauthenticated")
+
+// AuthTokenMiddleware authenticates the request with either a JWT
+// ("Authorization: Bearer ...") or a personal API key ("Authorization: ApiKey ...").
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -22,52 +30,200 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 {
 			pkg.UnAuthorizedErrorResponse(w, r, fmt.Errorf("authorization header is malformed"))
 			return
 		}
 
-		token := parts[1]
-		jwtToken, err := app.authenticator.ValidateToken(token)
+		ctx := r.Context()
+		var (
+			principal *Principal
+			err       error
+		)
+		switch parts[0] {
+		case "Bearer":
+			principal, err = app.bearerPrincipal(ctx, parts[1])
+		case "ApiKey":
+			principal, err = app.apiKeyPrincipal(ctx, parts[1])
+		default:
+			err = fmt.Errorf("%w: unsupported authorization scheme %q", errUnauthenticated, parts[0])
+		}
 		if err != nil {
-			pkg.UnAuthorizedErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, errUnauthenticated):
+				pkg.UnAuthorizedErrorResponse(w, r, err)
+			default:
+				pkg.InternalServerError(w, r, err)
+			}
 			return
 		}
 
-		claims := jwtToken.Claims.(jwt.MapClaims)
+		ctx = context.WithValue(ctx, principalCtx, principal)
 
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
-		if err != nil {
-			pkg.UnAuthorizedErrorResponse(w, r, err)
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+	})
+}
+
+func (app *application) bearerPrincipal(ctx context.Context, token string) (*Principal, error) {
+	claims, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnauthenticated, err)
+	}
+
+	if claims.HasScope(auth.ScopeMFAPending) {
+		return nil, fmt.Errorf("%w: two-factor login has not been completed", errUnauthenticated)
+	}
+
+	denied, err := app.cacheStorage.Tokens.IsDenied(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if denied {
+		return nil, fmt.Errorf("%w: token %s has been revoked", errUnauthenticated, claims.ID)
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnauthenticated, err)
+	}
+
+	session, err := app.store.Sessions.GetByID(ctx, claims.SessionID)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return nil, fmt.Errorf("%w: session has been revoked", errUnauthenticated)
+		}
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, fmt.Errorf("%w: session does not belong to the token subject", errUnauthenticated)
+	}
+
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnauthenticated, err)
+	}
+
+	if err := app.store.Sessions.Touch(ctx, session.ID); err != nil {
+		app.logger.Errorw("error recording session activity", "error", err)
+	}
+
+	return &Principal{User: user, Claims: claims}, nil
+}
+
+func (app *application) apiKeyPrincipal(ctx context.Context, key string) (*Principal, error) {
+	apiKey, err := app.store.APIKeys.GetByHash(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return nil, fmt.Errorf("%w: unknown, expired or revoked api key", errUnauthenticated)
+		}
+		return nil, err
+	}
+
+	user, err := app.getUser(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnauthenticated, err)
+	}
+
+	if err := app.store.APIKeys.Touch(ctx, apiKey.ID); err != nil {
+		app.logger.Errorw("error recording api key use", "error", err)
+	}
+
+	return &Principal{User: user, APIKey: apiKey}, nil
+}
+
+// RequireScope lets API keys through only when they were granted scope.
+// Logged in users are not limited by scopes.
+func (app *application) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := getPrincipalFromContext(r)
+			if principal == nil || !principal.HasScope(scope) {
+				pkg.ForbiddenErrorResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUserSession refuses API keys on routes that manage the account
+// itself, so a leaked key can't be used to mint more keys or change security
+// settings.
+func (app *application) RequireUserSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := getPrincipalFromContext(r)
+		if principal == nil || principal.APIKey != nil {
+			pkg.ForbiddenErrorResponse(w, r)
 			return
 		}
 
-		ctx := r.Context()
-		user, err := app.getUser(ctx, types.ID(userID))
-		if err != nil {
-			pkg.UnAuthorizedErrorResponse(w, r, err)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission lets the request through only if the caller's role grants
+// permission.
+func (app *application) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.hasPermission(r.Context(), getPrincipalFromContext(r).User, permission)
+			if err != nil {
+				pkg.InternalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				pkg.ForbiddenErrorResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkPostOwnerShip lets the owner of the post through, and everyone else
+// only if their role grants permission.
+func (app *application) checkPostOwnerShip(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getPrincipalFromContext(r).User
+		post := getPostFromContext(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		ctx = context.WithValue(ctx, userCtx, user)
+		allowed, err := app.hasPermission(r.Context(), user, permission)
+		if err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if !allowed {
+			pkg.ForbiddenErrorResponse(w, r)
+			return
+		}
 
+		next.ServeHTTP(w, r)
 	})
 }
 
-func (app *application) checkPostOwnerShip(role string, next http.HandlerFunc) http.HandlerFunc {
+// checkCommentOwnership lets the author of the comment through, and everyone
+// else only if their role grants permission.
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := getUserFromContext(r)
-		post := 1 //getPostFromContext(r)
+		user := getPrincipalFromContext(r).User
+		comment := getCommentFromContext(r)
 
-		if post == int(user.ID) {
+		if comment.UserID == user.ID {
 			next.ServeHTTP(w, r)
 			return
-
 		}
 
-		allowed, err := app.checkRolePrecedence(r.Context(), user, role)
+		allowed, err := app.hasPermission(r.Context(), user, permission)
 		if err != nil {
 			pkg.InternalServerError(w, r, err)
 			return
@@ -82,13 +238,33 @@ func (app *application) checkPostOwnerShip(role string, next http.HandlerFunc) h
 	})
 }
 
-func (app application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
+func (app application) hasPermission(ctx context.Context, user *store.User, permission string) (bool, error) {
+	role, err := app.getRole(ctx, user.Role.ID)
 	if err != nil {
 		return false, err
 	}
 
-	return types.ID(user.Role.Level) >= types.ID(role.Level), nil
+	return role.HasPermission(permission), nil
+}
+
+func (app application) getRole(ctx context.Context, roleID types.ID) (*store.Role, error) {
+	role, err := app.cacheStorage.Roles.Get(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		role, err = app.store.Roles.GetByID(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Roles.Set(ctx, role); err != nil {
+			return nil, err
+		}
+	}
+
+	return role, nil
 }
 
 func (app application) getUser(ctx context.Context, userID types.ID) (*store.User, error) {
@@ -98,7 +274,7 @@ func (app application) getUser(ctx context.Context, userID types.ID) (*store.Use
 	}
 
 	if user == nil {
-		user, err := app.store.Users.GetByID(ctx, types.ID(userID))
+		user, err = app.store.Users.GetByID(ctx, types.ID(userID))
 		if err != nil {
 			return nil, err
 		}
@@ -114,7 +290,7 @@ func (app application) getUser(ctx context.Context, userID types.ID) (*store.Use
 
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.rateLimiter.Enabled {
+		if app.config.RateLimiter.Enabled {
 			if allow, retryAfter := app.rateLimiter.Allow(r.RemoteAddr); !allow {
 				pkg.RateLimitExceededErrorResponse(w, r, retryAfter.String())
 				return
@@ -124,41 +300,45 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
-// 	return func(next http.Handler) http.Handler {
-// 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-// 			// read the auth header
-// 			authHeader := r.Header.Get("Authorization")
-// 			if authHeader == "" {
-// 				pkg.UnAuthorizedBasicErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
-// 				return
-// 			}
-
-// 			// parse it -> get the base64
-// 			parts := strings.Split(authHeader, " ")
-// 			if len(parts) != 2 || parts[0] != "Basic" {
-// 				return
-// 			}
-
-// 			// decode it
-// 			decoded, err := base64.StdEncoding.DecodeString(parts[1])
-// 			if err != nil {
-// 				pkg.UnAuthorizedErrorResponse(w, r, err)
-// 				return
-// 			}
-
-// 			// check the credentials
-// 			username := app.config.auth.basic.username
-// 			pass := app.config.auth.basic.password
-
-// 			creds := strings.SplitN(string(decoded), ":", 2)
-// 			if len(creds) != 2 || creds[0] != username || creds[1] != pass {
-// 				pkg.UnAuthorizedErrorResponse(w, r, fmt.Errorf("invalid credentials"))
-// 				return
-// 			}
-
-// 			next.ServeHTTP(w, r)
-// 		})
-// 	}
-// }
+// allowEmail reports whether another mail may be sent to email right now.
+func (app *application) allowEmail(email string) bool {
+	if !app.config.EmailRateLimiter.Enabled {
+		return true
+	}
+
+	allow, _ := app.emailRateLimiter.Allow(strings.ToLower(strings.TrimSpace(email)))
+	return allow
+}
+
+// BasicAuthMiddleware guards operational endpoints with the configured basic
+// auth credentials, for tools that have no user account.
+func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				pkg.UnAuthorizedBasicErrorResponse(w, r, fmt.Errorf("basic authorization header is missing or malformed"))
+				return
+			}
+
+			basic := app.config.Auth.Basic
+			usernameMatch := constantTimeEqual(username, basic.Username)
+			passwordMatch := constantTimeEqual(password, string(basic.Password))
+			if !usernameMatch || !passwordMatch {
+				pkg.UnAuthorizedBasicErrorResponse(w, r, fmt.Errorf("invalid credentials"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// constantTimeEqual hashes both sides first so that not even the length of the
+// expected value leaks through timing.
+func constantTimeEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/internal/store/cache"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errOIDCEmailRequired = errors.New("the identity provider did not share a verified email")
+	errOIDCInactiveUser  = errors.New("an account with this email exists but has not been activated")
+)
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcStartHandler godoc
+//
+//	@Summary		Starts an OpenID Connect login
+//	@Description	Redirects to the identity provider. The provider sends the user back to the callback endpoint.
+//	@Tags			authentication
+//	@Param			provider	path		string	true	"Provider name"
+//	@Success		302			{string}	string	"Redirect to the provider"
+//	@Failure		404			{object}	error
+//	@Router			/auth/oidc/{provider}/start [get]
+func (app *application) oidcStartHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		pkg.NotFoundError(w, r, errors.New("unknown identity provider"))
+		return
+	}
+
+	state, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	nonce, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	redirectURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	data := &cache.OIDCState{
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+	}
+	if err := app.cacheStorage.OIDCStates.Set(ctx, state, data, app.config.Auth.OIDC.StateExp); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// oidcCallbackHandler godoc
+//
+//	@Summary		Completes an OpenID Connect login
+//	@Description	Exchanges the authorization code for the user's identity, links it to an account (creating one if needed) and logs in
+//	@Tags			authentication
+//	@Produce		json
+//	@Param			provider	path		string	true	"Provider name"
+//	@Param			code		query		string	true	"Authorization code"
+//	@Param			state		query		string	true	"State from the start endpoint"
+//	@Success		201			{object}	TokenResponse			"Access and refresh token"
+//	@Success		200			{object}	MFAChallengeResponse	"Two-factor code required"
+//	@Failure		401			{object}	error
+//	@Failure		409			{object}	error
+//	@Router			/auth/oidc/{provider}/callback [get]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		pkg.NotFoundError(w, r, errors.New("unknown identity provider"))
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		pkg.UnAuthorizedErrorResponse(w, r, fmt.Errorf("identity provider returned %s: %s", e, q.Get("error_description")))
+		return
+	}
+
+	ctx := r.Context()
+	state, err := app.cacheStorage.OIDCStates.Take(ctx, q.Get("state"))
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if state == nil || state.Provider != provider.Name {
+		pkg.UnAuthorizedErrorResponse(w, r, errors.New("login state is invalid or has expired"))
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, q.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrOIDCCodeRejected), errors.Is(err, auth.ErrOIDCInvalidIDToken):
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.oidcUser(ctx, provider.Name, identity)
+	if err != nil {
+		switch err {
+		case errOIDCEmailRequired:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+		case errOIDCInactiveUser, store.ErrorConflict:
+			pkg.ConflictErrorResponse(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// oidcUser finds the user an external identity belongs to. Unknown identities
+// are linked to the active user with the same verified email, or get a new
+// active user.
+func (app *application) oidcUser(ctx context.Context, provider string, identity *auth.OIDCIdentity) (*store.User, error) {
+	linked, err := app.store.Identities.Get(ctx, provider, identity.Subject)
+	switch err {
+	case nil:
+		user, err := app.store.Users.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.IsActive {
+			return nil, errOIDCInactiveUser
+		}
+		return user, nil
+	case store.ErrorNotFound:
+	default:
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errOIDCEmailRequired
+	}
+
+	link := &store.Identity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, identity.Email)
+	switch err {
+	case nil:
+		link.UserID = user.ID
+		if err := app.store.Identities.Link(ctx, link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case store.ErrorNotFound:
+	default:
+		return nil, err
+	}
+
+	// nobody can log in with this password; a reset link sets a real one
+	password, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hashPassword, err := app.passwords.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	base := oidcUsername(identity)
+	for attempt := 0; ; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, _, err := auth.NewOpaqueToken()
+			if err != nil {
+				return nil, err
+			}
+			username = fmt.Sprintf("%s_%s", base, strings.ToLower(suffix[:6]))
+		}
+
+		user := &store.User{
+			Username: username,
+			Email:    identity.Email,
+			Password: hashPassword,
+			Role: store.Role{
+				Name: "user",
+			},
+		}
+
+		err := app.store.Users.CreateWithIdentity(ctx, user, link)
+		switch {
+		case err == nil:
+			return app.store.Users.GetByID(ctx, user.ID)
+		case err == store.ErrDuplicateUsername && attempt < 3:
+			continue
+		case err == store.ErrDuplicateEmail:
+			return nil, errOIDCInactiveUser
+		default:
+			return nil, err
+		}
+	}
+}
+
+// oidcUsername derives a username from the provider's preferred username or
+// the local part of the email.
+func oidcUsername(identity *auth.OIDCIdentity) string {
+	name := identity.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	name = usernameDisallowed.ReplaceAllString(name, "")
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	if name == "" {
+		name = "user"
+	}
+
+	return name
+}
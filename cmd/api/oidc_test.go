@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/internal/config"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/internal/store/cache"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const testClientID = "social-app"
+
+// testIdP is a minimal OpenID provider. It hands out one code per login and
+// redeems it only with the PKCE verifier of the challenge it was issued for.
+type testIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testGrant
+
+	// tamper changes the id token claims before they are signed.
+	tamper func(claims jwt.MapClaims)
+}
+
+type testGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{key: key, codes: map[string]testGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{{
+			Kty: "RSA",
+			Kid: "test",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// approve plays the user logging in at the provider: it takes the
+// authorization URL the app redirected to and returns the code.
+func (idp *testIdP) approve(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	if got := q.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", got)
+	}
+	if q.Get("client_id") != testClientID || q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("incomplete authorization request: %s", authURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	code = "code-" + q.Get("state")
+	idp.codes[code] = testGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+
+	return code, q.Get("state")
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "gopher@example.com",
+		"email_verified": true,
+		"nonce":          grant.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	}
+	if idp.tamper != nil {
+		idp.tamper(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// The fakes embed the Postgres and Redis stores for the interface methods
+// and override only what a login through an already linked identity uses.
+
+type fakeIdentities struct{ store.IdentityStore }
+
+func (fakeIdentities) Get(ctx context.Context, provider, subject string) (*store.Identity, error) {
+	if provider != "test" || subject != "subject-1" {
+		return nil, store.ErrorNotFound
+	}
+	return &store.Identity{Provider: provider, Subject: subject, UserID: 1}, nil
+}
+
+type fakeUsers struct{ store.UserStore }
+
+func (fakeUsers) GetByID(ctx context.Context, id types.ID) (*store.User, error) {
+	return &store.User{ID: id, Username: "gopher", Email: "gopher@example.com", IsActive: true, Role: store.Role{Name: "user"}}, nil
+}
+
+func (fakeUsers) CancelDeletion(ctx context.Context, id types.ID) (bool, error) {
+	return false, nil
+}
+
+type fakeMFA struct{ store.MFAStore }
+
+func (fakeMFA) Get(ctx context.Context, userID types.ID) (*store.MFA, error) {
+	return nil, store.ErrorNotFound
+}
+
+type fakeSessions struct{ store.SessionStore }
+
+func (fakeSessions) Create(ctx context.Context, session *store.Session, token *store.RefreshToken, hash []byte) error {
+	session.ID = "session-1"
+	return nil
+}
+
+type fakeOIDCStates struct {
+	mu     sync.Mutex
+	states map[string]*cache.OIDCState
+}
+
+func (s *fakeOIDCStates) Set(ctx context.Context, state string, data *cache.OIDCState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = data
+	return nil
+}
+
+func (s *fakeOIDCStates) Take(ctx context.Context, state string) (*cache.OIDCState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.states[state]
+	delete(s.states, state)
+	return data, nil
+}
+
+func newOIDCTestServer(t *testing.T, idp *testIdP) *httptest.Server {
+	t.Helper()
+
+	cfg := config.Config{}
+	cfg.Auth.OIDC.StateExp = time.Minute
+	cfg.Auth.Token.Exp = time.Minute
+	cfg.Auth.Token.RefreshExp = time.Hour
+
+	app := &application{
+		config:        cfg,
+		logger:        zap.NewNop().Sugar(),
+		authenticator: auth.NewJWTAuthenticator("test-secret", "test", "test"),
+		store: store.Storage{
+			Identities: fakeIdentities{},
+			Users:      fakeUsers{},
+			MFA:        fakeMFA{},
+			Sessions:   fakeSessions{},
+		},
+		cacheStorage: cache.Storage{
+			OIDCStates: &fakeOIDCStates{states: map[string]*cache.OIDCState{}},
+		},
+		oidcProviders: map[string]*auth.OIDCProvider{
+			"test": auth.NewOIDCProvider(auth.OIDCProviderOptions{
+				Name:        "test",
+				Issuer:      idp.URL,
+				ClientID:    testClientID,
+				RedirectURL: "http://app.test/v1/auth/oidc/test/callback",
+			}),
+		},
+	}
+
+	r := chi.NewRouter()
+	r.Get("/auth/oidc/{provider}/start", app.oidcStartHandler)
+	r.Get("/auth/oidc/{provider}/callback", app.oidcCallbackHandler)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// startOIDCLogin follows the app to the provider and back, returning the
+// callback URL the provider would redirect the browser to.
+func startOIDCLogin(t *testing.T, srv *httptest.Server, idp *testIdP) string {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, err := client.Get(srv.URL + "/auth/oidc/test/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("start: status = %d, want %d", res.StatusCode, http.StatusFound)
+	}
+
+	code, state := idp.approve(t, res.Header.Get("Location"))
+
+	return srv.URL + "/auth/oidc/test/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+}
+
+func callbackStatus(t *testing.T, callbackURL string) int {
+	t.Helper()
+
+	res, err := http.Get(callbackURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestOIDCCallback(t *testing.T) {
+	t.Run("logs in and redeems the state once", func(t *testing.T) {
+		idp := newTestIdP(t)
+		srv := newOIDCTestServer(t, idp)
+
+		callbackURL := startOIDCLogin(t, srv, idp)
+
+		res, err := http.Get(callbackURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusCreated)
+		}
+
+		var body struct {
+			Data TokenResponse `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.AccessToken == "" || body.Data.RefreshToken == "" {
+			t.Fatalf("missing tokens in %+v", body.Data)
+		}
+
+		if got := callbackStatus(t, callbackURL); got != http.StatusUnauthorized {
+			t.Fatalf("replayed state: status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("rejects an unknown state", func(t *testing.T) {
+		idp := newTestIdP(t)
+		srv := newOIDCTestServer(t, idp)
+
+		got := callbackStatus(t, srv.URL+"/auth/oidc/test/callback?code=code-x&state=unknown")
+		if got != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("rejects a code issued for another PKCE challenge", func(t *testing.T) {
+		idp := newTestIdP(t)
+		srv := newOIDCTestServer(t, idp)
+
+		callbackURL := startOIDCLogin(t, srv, idp)
+		idp.mu.Lock()
+		for code, grant := range idp.codes {
+			grant.challenge = "someone-elses-challenge"
+			idp.codes[code] = grant
+		}
+		idp.mu.Unlock()
+
+		if got := callbackStatus(t, callbackURL); got != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	tampered := map[string]func(jwt.MapClaims){
+		"rejects a wrong nonce":  func(c jwt.MapClaims) { c["nonce"] = "replayed-nonce" },
+		"rejects a wrong issuer": func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+	}
+	for name, tamper := range tampered {
+		t.Run(name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			idp.tamper = tamper
+			srv := newOIDCTestServer(t, idp)
+
+			if got := callbackStatus(t, startOIDCLogin(t, srv, idp)); got != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
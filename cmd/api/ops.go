@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+type VersionResponse struct {
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	Revision  string    `json:"revision,omitempty"`
+	BuiltAt   string    `json:"built_at,omitempty"`
+	Modified  bool      `json:"modified"`
+	Env       string    `json:"env"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+var startedAt = time.Now()
+
+// publishExpvars adds the application's own values to /v1/ops/debug/vars,
+// next to the memstats and cmdline that expvar publishes by itself.
+func publishExpvars(db *sql.DB) {
+	expvar.NewString("version").Set(version)
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("database", expvar.Func(func() any {
+		return db.Stats()
+	}))
+}
+
+// opsRoutes mounts the operational endpoints. They are guarded by basic auth
+// only, so ops can reach them without a user account.
+func (app *application) opsRoutes(r chi.Router) {
+	r.Use(app.BasicAuthMiddleware())
+
+	r.Get("/version", app.versionHandler)
+	r.Get("/db", app.dbStatsHandler)
+	r.Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+	// pprof.Index only serves named profiles under /debug/pprof/, so they are
+	// routed explicitly here
+	r.Get("/debug/pprof/", pprof.Index)
+	r.Get("/debug/pprof/cmdline", pprof.Cmdline)
+	r.Get("/debug/pprof/profile", sampled(pprof.Profile))
+	r.Get("/debug/pprof/symbol", pprof.Symbol)
+	r.Post("/debug/pprof/symbol", pprof.Symbol)
+	r.Get("/debug/pprof/trace", sampled(pprof.Trace))
+	r.Get("/debug/pprof/{profile}", sampled(func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	}))
+}
+
+// sampled lets a pprof handler that samples for ?seconds= outlive the
+// server's WriteTimeout. The duration stays bounded by requestTimeout.
+func sampled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			seconds, err := strconv.ParseFloat(s, 64)
+			if err != nil || seconds <= 0 {
+				pkg.BadRequestError(w, r, errors.New("seconds must be a positive number"))
+				return
+			}
+			if seconds >= requestTimeout.Seconds() {
+				pkg.BadRequestError(w, r, fmt.Errorf("seconds must be less than %v", requestTimeout.Seconds()))
+				return
+			}
+		}
+
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// versionHandler godoc
+//
+//	@Summary		Build information
+//	@Description	Reports the version, Go toolchain and VCS revision the server was built from
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	VersionResponse
+//	@Security		BasicAuth
+//	@Router			/ops/version [get]
+func (app *application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	res := VersionResponse{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Env:       app.config.Env,
+		StartedAt: startedAt,
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				res.Revision = s.Value
+			case "vcs.time":
+				res.BuiltAt = s.Value
+			case "vcs.modified":
+				res.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, res); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// dbStatsHandler godoc
+//
+//	@Summary		Database pool statistics
+//	@Description	Reports the connection pool statistics of the Postgres handle
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	sql.DBStats
+//	@Security		BasicAuth
+//	@Router			/ops/db [get]
+func (app *application) dbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := pkg.JsonResponse(w, http.StatusOK, app.db.Stats()); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
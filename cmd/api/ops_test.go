@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"testing"
+	"time"
+)
+
+func TestSampledOutlivesWriteTimeout(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"profile": pprof.Profile,
+		"trace":   pprof.Trace,
+		// writes only after the deadline, with nothing of pprof's own to
+		// extend it
+		"slow writer": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(2 * time.Second)
+			w.Write([]byte("done"))
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewUnstartedServer(sampled(handler))
+			srv.Config.WriteTimeout = time.Second
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			res, err := http.Get(srv.URL + "?seconds=2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, http.StatusOK, body)
+			}
+			if len(body) == 0 {
+				t.Fatal("empty body")
+			}
+		})
+	}
+}
+
+func TestSampledRejectsLongDurations(t *testing.T) {
+	for _, seconds := range []string{"0", "-1", "abc", "60", "600"} {
+		res := httptest.NewRecorder()
+		sampled(pprof.Profile)(res, httptest.NewRequest(http.MethodGet, "/?seconds="+seconds, nil))
+
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("seconds=%s: status = %d, want %d", seconds, res.Code, http.StatusBadRequest)
+		}
+	}
+}
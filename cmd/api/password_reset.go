@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/internal/mailer"
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+var errResetTokenInvalid = errors.New("reset token is invalid or has expired")
+
+const forgotPasswordMessage = "if an account with that email exists, a reset link has been sent"
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Requests a password reset
+//	@Description	Emails a one-time password reset link. The response is the same for unknown and throttled emails.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordPayload	true	"Account email"
+//	@Success		202		{string}	string					"Reset link sent"
+//	@Router			/auth/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	// sent in the background, so neither the response nor its timing tells
+	// whether the account exists
+	ctx := context.WithoutCancel(r.Context())
+	app.background(func() {
+		if err := app.sendPasswordReset(ctx, payload.Email); err != nil {
+			app.logger.Errorw("error sending password reset email", "error", err)
+		}
+	})
+
+	if err := pkg.JsonResponse(w, http.StatusAccepted, forgotPasswordMessage); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) sendPasswordReset(ctx context.Context, email string) error {
+	if !app.allowEmail(email) {
+		app.logger.Infow("password reset throttled")
+		return nil
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if err == store.ErrorNotFound {
+			return nil
+		}
+		return err
+	}
+
+	token, err := app.store.Tokens.New(ctx, user.ID, store.PurposePasswordReset, app.config.Mail.ResetExp)
+	if err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.FrontEndURL, token.Plaintext),
+		ExpiresIn: app.config.Mail.ResetExp.String(),
+	}
+
+	return app.sendMail(mailer.PasswordResetTemplate, user.Username, user.Email, vars)
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password with a reset token and logs out every session of the account
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body		ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		204		{string}	string					"Password reset"
+//	@Failure		400		{object}	error
+//	@Failure		422		{object}	error
+//	@Router			/auth/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// the policy needs the account, so peek at the token before redeeming it
+	userID, err := app.store.Tokens.Lookup(ctx, payload.Token, store.PurposePasswordReset)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.BadRequestError(w, r, errResetTokenInvalid)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	fields := map[string][]string{}
+	app.checkPassword(fields, "password", payload.Password, user.Username, user.Email)
+	if len(fields) > 0 {
+		pkg.FailedValidationResponse(w, r, fields)
+		return
+	}
+
+	hashPassword, err := app.passwords.Hash(payload.Password)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	userID, err = app.store.Users.ResetPassword(ctx, payload.Token, hashPassword)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.BadRequestError(w, r, errResetTokenInvalid)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("password reset", "user_id", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/pkg"
+)
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// checkPassword records under field every policy rule the new password breaks.
+func (app *application) checkPassword(fields map[string][]string, field, password, username, email string) {
+	if problems := app.passwordPolicy.Check(password, username, email); len(problems) > 0 {
+		fields[field] = append(fields[field], problems...)
+	}
+}
+
+// changePasswordHandler godoc
+//
+//	@Summary		Changes the caller's password
+//	@Description	Replaces the password after checking the current one and logs out every other session
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body		ChangePasswordPayload	true	"Current and new password"
+//	@Success		204		{string}	string					"Password changed"
+//	@Failure		401		{object}	error					"Account locked"
+//	@Failure		422		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/password [put]
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangePasswordPayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	principal := getPrincipalFromContext(r)
+
+	// the cached user carries no password hash
+	user, err := app.store.Users.GetByID(ctx, principal.User.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	fields := map[string][]string{}
+
+	if err := app.verifyCurrentPassword(ctx, user, payload.CurrentPassword); err != nil {
+		switch err {
+		case errAccountLocked:
+			pkg.UnAuthorizedErrorResponse(w, r, err)
+			return
+		case pkg.ErrMismatchedPassword:
+			fields["current_password"] = []string{"is incorrect"}
+		default:
+			pkg.InternalServerError(w, r, err)
+			return
+		}
+	}
+
+	if payload.NewPassword == payload.CurrentPassword {
+		fields["new_password"] = []string{"must differ from the current password"}
+	}
+	app.checkPassword(fields, "new_password", payload.NewPassword, user.Username, user.Email)
+
+	if len(fields) > 0 {
+		pkg.FailedValidationResponse(w, r, fields)
+		return
+	}
+
+	hashPassword, err := app.passwords.Hash(payload.NewPassword)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ChangePassword(ctx, user.ID, hashPassword, principal.Claims.SessionID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("password changed", "user_id", user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
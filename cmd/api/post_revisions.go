@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+// PostRevisionDiff has From null when the diff starts from an empty post.
+type PostRevisionDiff struct {
+	From *int   `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// listPostRevisionsHandler godoc
+//
+//	@Summary		Lists the revisions of a post
+//	@Description	Every edit of a post is kept as a revision. Only the author, or a role allowed to edit any post, may see them.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Page size, 1 to 100"	default(20)
+//	@Param			offset	query		int		false	"Revisions to skip"		default(0)
+//	@Param			sort	query		string	false	"desc (newest first) or asc"
+//	@Success		200		{array}		store.PostRevision
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/revisions [get]
+func (app *application) listPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	paginate := pkg.PaginationQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	p, err := paginate.Parse(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), getPostFromContext(r).ID, p)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, revisions); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// postRevisionDiffHandler godoc
+//
+//	@Summary		Compares two revisions of a post
+//	@Description	Returns a line-level unified diff of title, tags and content from one revision to another. The first revision is compared with an empty post.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Param			version	path		int	true	"Revision to compare to"
+//	@Param			from	query		int	false	"Revision to compare from, the one before version by default"
+//	@Success		200		{object}	PostRevisionDiff
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		422		{object}	error	"Revisions too large to compare"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/revisions/{version}/diff [get]
+func (app *application) postRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 0 {
+		pkg.BadRequestError(w, r, errors.New("version must be a non-negative number"))
+		return
+	}
+
+	from := version - 1
+	if f := r.URL.Query().Get("from"); f != "" {
+		from, err = strconv.Atoi(f)
+		if err != nil || from < 0 {
+			pkg.BadRequestError(w, r, errors.New("from must be a non-negative number"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	post := getPostFromContext(r)
+
+	to, err := app.store.Posts.GetRevision(ctx, post.ID, version)
+	if err != nil {
+		revisionError(w, r, err)
+		return
+	}
+
+	// the first revision has nothing before it, so it shows up as added
+	var old *store.PostRevision
+	fromName := "/dev/null"
+	if from >= 0 {
+		old, err = app.store.Posts.GetRevision(ctx, post.ID, from)
+		if err != nil {
+			revisionError(w, r, err)
+			return
+		}
+		fromName = fmt.Sprintf("post/%d@%d", post.ID, old.Version)
+	}
+
+	text, err := diffRevisions(fromName, fmt.Sprintf("post/%d@%d", post.ID, to.Version), old, to)
+	if err != nil {
+		switch err {
+		case pkg.ErrDiffTooLarge:
+			pkg.FailedValidationResponse(w, r, map[string][]string{"version": {err.Error()}})
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	diff := PostRevisionDiff{To: to.Version, Diff: text}
+	if old != nil {
+		diff.From = &old.Version
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, diff); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// restorePostRevisionHandler godoc
+//
+//	@Summary		Restores an earlier revision of a post
+//	@Description	Saves the title, content and tags of the revision as a new version of the post. Only the author, or a role allowed to edit any post, may restore it.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			version		path		int		true	"Revision to restore"
+//	@Param			If-Match	header		string	false	"ETag of the post version the restore is based on"
+//	@Success		200			{object}	store.Post
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"The post was changed concurrently"
+//	@Failure		412			{object}	error	"If-Match does not match the current version"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/revisions/{version}/restore [post]
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 0 {
+		pkg.BadRequestError(w, r, errors.New("version must be a non-negative number"))
+		return
+	}
+
+	post := getPostFromContext(r)
+
+	precondition, matched := ifMatch(r, postETag(post))
+	if precondition && !matched {
+		pkg.PreconditionFailedResponse(w, r, post.Version)
+		return
+	}
+
+	rev, err := app.store.Posts.GetRevision(r.Context(), post.ID, version)
+	if err != nil {
+		revisionError(w, r, err)
+		return
+	}
+
+	post.Title = rev.Title
+	post.Content = rev.Content
+	post.Tags = rev.Tags
+
+	app.savePost(w, r, post, precondition)
+}
+
+// diffRevisions diffs the texts of two revisions. A panic in the diff is
+// returned as an error, so it ends in a 500 for this request only.
+func diffRevisions(fromName, toName string, old, to *store.PostRevision) (text string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("diffing revisions: %v", p)
+		}
+	}()
+
+	return pkg.UnifiedDiff(fromName, toName, revisionText(old), revisionText(to))
+}
+
+// revisionText renders a revision as the document its diffs are made of. A
+// nil revision is empty.
+func revisionText(rev *store.PostRevision) string {
+	if rev == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("title: %s\ntags: %s\n\n%s", rev.Title, strings.Join(rev.Tags, ", "), rev.Content)
+}
+
+func revisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		pkg.NotFoundError(w, r, err)
+	default:
+		pkg.InternalServerError(w, r, err)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/pkg"
@@ -11,6 +14,10 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+type postKey string
+
+const postCtx postKey = "post"
+
 type CreatePostRequest struct {
 	Content string   `json:"content"`
 	Title   string   `json:"title"`
@@ -30,7 +37,7 @@ func (app application) createPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user := getUserFromContext(r)
+	user := getPrincipalFromContext(r).User
 
 	post := store.Post{
 		UserID:  user.ID,
@@ -43,6 +50,7 @@ func (app application) createPostHandler(w http.ResponseWriter, r *http.Request)
 		pkg.InternalServerError(w, r, err)
 		return
 	}
+	post.Reactions = store.ReactionSummary{Counts: map[string]int{}, Viewer: []string{}}
 
 	if err := pkg.JsonResponse(w, http.StatusCreated, post); err != nil {
 		pkg.InternalServerError(w, r, err)
@@ -52,34 +60,29 @@ func (app application) createPostHandler(w http.ResponseWriter, r *http.Request)
 
 func (app application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
-	ctx := r.Context()
-	// fake data
-	postID := chi.URLParam(r, "postID")
-	id, err := strconv.ParseInt(postID, 10, 64)
+	post := getPostFromContext(r)
+
+	// only the first page of the tree, the rest is fetched from /comments/tree
+	comments, err := app.store.Comments.GetTree(r.Context(), post.ID, nil, defaultCommentTree)
 	if err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
 
-	post, err := app.store.Posts.GetByID(ctx, types.ID(id))
-	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrorNotFound):
-			pkg.NotFoundError(w, r, err)
-		default:
-			pkg.InternalServerError(w, r, err)
-		}
+	post.Comments = comments
+
+	viewerID := getPrincipalFromContext(r).User.ID
+	if err := app.attachPostReactions(r.Context(), viewerID, post); err != nil {
+		pkg.InternalServerError(w, r, err)
 		return
 	}
 
-	comments, err := app.store.Comments.GetByPostID(ctx, post.ID)
-	if err != nil {
+	if err := app.attachCommentReactions(r.Context(), viewerID, post.Comments...); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
 
-	post.Comments = comments
-
+	w.Header().Set("ETag", postETag(post))
 	if err := pkg.JsonResponse(w, http.StatusOK, post); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
@@ -88,13 +91,16 @@ func (app application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdatePost godoc
 // @Summary Updates a post
-// @Description Updates a post by ID
+// @Description Updates a post by ID. Send the ETag of the post as If-Match to make sure no one changed it since it was read.
 // @Tags posts
 // @Accept json
 // @Produce json
 // @Param id path int true "Post ID"
+// @Param If-Match header string false "ETag of the post version the update is based on"
 // @Param payload body UpdatePostPayload true "Post payload"
 // @Success 200 {object} store.Post
+// @Failure 409 {object} error "The post was changed concurrently"
+// @Failure 412 {object} error "If-Match does not match the current version"
 // @Security ApiKeyAuth
 // @Router /posts/{id} [patch]
 func (app application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -105,17 +111,37 @@ func (app application) updatePostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ctx := r.Context()
-	postID := chi.URLParam(r, "postID")
-	id, err := strconv.ParseInt(postID, 10, 64)
-	if err != nil {
-		pkg.InternalServerError(w, r, err)
+	post := getPostFromContext(r)
+
+	precondition, matched := ifMatch(r, postETag(post))
+	if precondition && !matched {
+		pkg.PreconditionFailedResponse(w, r, post.Version)
 		return
 	}
 
-	post, err := app.store.Posts.GetByID(ctx, types.ID(id))
-	if err != nil {
+	if postReq.Content != nil {
+		post.Content = *postReq.Content
+	}
+	if postReq.Title != nil {
+		post.Title = *postReq.Title
+	}
+
+	app.savePost(w, r, post, precondition)
+}
+
+// savePost stores the changes made to post and responds with the new
+// version. precondition tells whether the client sent If-Match, which turns
+// an edit conflict into a failed precondition.
+func (app application) savePost(w http.ResponseWriter, r *http.Request, post *store.Post, precondition bool) {
+	ctx := r.Context()
+	user := getPrincipalFromContext(r).User
+
+	if err := app.store.Posts.Update(ctx, post, user.ID); err != nil {
 		switch {
+		case errors.Is(err, store.ErrorEditConflict) && precondition:
+			pkg.PreconditionFailedResponse(w, r, post.Version)
+		case errors.Is(err, store.ErrorEditConflict):
+			pkg.EditConflictResponse(w, r, post.Version)
 		case errors.Is(err, store.ErrorNotFound):
 			pkg.NotFoundError(w, r, err)
 		default:
@@ -124,19 +150,13 @@ func (app application) updatePostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if postReq.Content != nil {
-		post.Content = *postReq.Content
-	}
-	if postReq.Title != nil {
-		post.Title = *postReq.Title
-	}
-
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	if err := app.attachPostReactions(ctx, user.ID, post); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
 
-	if err := pkg.JsonResponse(w, http.StatusCreated, post); err != nil {
+	w.Header().Set("ETag", postETag(post))
+	if err := pkg.JsonResponse(w, http.StatusOK, post); err != nil {
 		pkg.InternalServerError(w, r, err)
 		return
 	}
@@ -144,16 +164,9 @@ func (app application) updatePostHandler(w http.ResponseWriter, r *http.Request)
 
 func (app application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
 
-	ctx := r.Context()
+	post := getPostFromContext(r)
 
-	postID := chi.URLParam(r, "postID")
-	id, err := strconv.ParseInt(postID, 10, 64)
-	if err != nil {
-		pkg.InternalServerError(w, r, err)
-		return
-	}
-
-	if err := app.store.Posts.Delete(ctx, types.ID(id)); err != nil {
+	if err := app.store.Posts.Delete(r.Context(), post.ID); err != nil {
 
 		switch {
 		case errors.Is(err, store.ErrorNotFound):
@@ -167,3 +180,63 @@ func (app application) deletePostHandler(w http.ResponseWriter, r *http.Request)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// postContextMiddleware loads the post named by the postID URL parameter once
+// for the handlers and ownership checks below it.
+func (app application) postContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+		if err != nil {
+			pkg.BadRequestError(w, r, err)
+			return
+		}
+
+		post, err := app.store.Posts.GetByID(ctx, types.ID(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				pkg.NotFoundError(w, r, err)
+			default:
+				pkg.InternalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, postCtx, post)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getPostFromContext(r *http.Request) *store.Post {
+	post, _ := r.Context().Value(postCtx).(*store.Post)
+	return post
+}
+
+// postETag identifies a version of a post. Every update bumps the version, so
+// it changes whenever the post does.
+func postETag(post *store.Post) string {
+	return fmt.Sprintf(`"%d"`, post.Version)
+}
+
+// ifMatch reports whether the request carries an If-Match header and whether
+// it matches etag. Weak tags never match, as If-Match compares strongly.
+func ifMatch(r *http.Request, etag string) (present bool, matched bool) {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return false, false
+	}
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || tag == etag {
+				return true, true
+			}
+		}
+	}
+
+	return true, false
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+)
+
+var errUnknownReaction = errors.New("unknown reaction")
+
+// addPostReactionHandler godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Adds a like or emoji reaction of the caller. Adding it again changes nothing.
+//	@Tags			reactions
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			reaction	path		string	true	"like or an emoji"
+//	@Success		204			{string}	string	"Reaction added"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{reaction} [put]
+func (app *application) addPostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.addReaction(w, r, store.ReactionTargetPost, getPostFromContext(r).ID)
+}
+
+// removePostReactionHandler godoc
+//
+//	@Summary		Removes a reaction from a post
+//	@Tags			reactions
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			reaction	path		string	true	"like or an emoji"
+//	@Success		204			{string}	string	"Reaction removed"
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{reaction} [delete]
+func (app *application) removePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.removeReaction(w, r, store.ReactionTargetPost, getPostFromContext(r).ID)
+}
+
+// listPostReactionsHandler godoc
+//
+//	@Summary		Lists the reactions to a post
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Page size, 1 to 100"	default(20)
+//	@Param			offset	query		int		false	"Reactions to skip"		default(0)
+//	@Param			sort	query		string	false	"desc (newest first) or asc"
+//	@Success		200		{array}		store.Reaction
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [get]
+func (app *application) listPostReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listReactions(w, r, store.ReactionTargetPost, getPostFromContext(r).ID)
+}
+
+// addCommentReactionHandler godoc
+//
+//	@Summary		Reacts to a comment
+//	@Description	Adds a like or emoji reaction of the caller. Adding it again changes nothing.
+//	@Tags			reactions
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			reaction	path		string	true	"like or an emoji"
+//	@Success		204			{string}	string	"Reaction added"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/reactions/{reaction} [put]
+func (app *application) addCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	if comment.Deleted {
+		pkg.NotFoundError(w, r, store.ErrorNotFound)
+		return
+	}
+
+	app.addReaction(w, r, store.ReactionTargetComment, comment.ID)
+}
+
+// removeCommentReactionHandler godoc
+//
+//	@Summary		Removes a reaction from a comment
+//	@Tags			reactions
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			reaction	path		string	true	"like or an emoji"
+//	@Success		204			{string}	string	"Reaction removed"
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/reactions/{reaction} [delete]
+func (app *application) removeCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.removeReaction(w, r, store.ReactionTargetComment, getCommentFromContext(r).ID)
+}
+
+// listCommentReactionsHandler godoc
+//
+//	@Summary		Lists the reactions to a comment
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			limit		query		int		false	"Page size, 1 to 100"	default(20)
+//	@Param			offset		query		int		false	"Reactions to skip"		default(0)
+//	@Param			sort		query		string	false	"desc (newest first) or asc"
+//	@Success		200			{array}		store.Reaction
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/reactions [get]
+func (app *application) listCommentReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listReactions(w, r, store.ReactionTargetComment, getCommentFromContext(r).ID)
+}
+
+func (app *application) addReaction(w http.ResponseWriter, r *http.Request, target store.ReactionTarget, targetID types.ID) {
+	reaction, err := reactionFromURL(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	user := getPrincipalFromContext(r).User
+	if err := app.store.Reactions.Add(r.Context(), user.ID, target, targetID, reaction); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removeReaction(w http.ResponseWriter, r *http.Request, target store.ReactionTarget, targetID types.ID) {
+	reaction, err := reactionFromURL(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	user := getPrincipalFromContext(r).User
+	if err := app.store.Reactions.Remove(r.Context(), user.ID, target, targetID, reaction); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) listReactions(w http.ResponseWriter, r *http.Request, target store.ReactionTarget, targetID types.ID) {
+	paginate := pkg.PaginationQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	p, err := paginate.Parse(r)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	reactions, err := app.store.Reactions.List(r.Context(), target, targetID, p)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, reactions); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// reactionFromURL reads the reaction URL parameter, which arrives percent
+// encoded when it is an emoji.
+func reactionFromURL(r *http.Request) (string, error) {
+	reaction, err := url.PathUnescape(chi.URLParam(r, "reaction"))
+	if err != nil || !store.IsReaction(reaction) {
+		return "", errUnknownReaction
+	}
+
+	return reaction, nil
+}
+
+// attachPostReactions fills in the reaction summaries of posts with a single
+// query.
+func (app *application) attachPostReactions(ctx context.Context, viewerID types.ID, posts ...*store.Post) error {
+	ids := make([]types.ID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	summaries, err := app.store.Reactions.Summaries(ctx, store.ReactionTargetPost, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Reactions = summaries[post.ID]
+	}
+
+	return nil
+}
+
+// attachCommentReactions fills in the reaction summaries of comments and all
+// their loaded replies with a single query.
+func (app *application) attachCommentReactions(ctx context.Context, viewerID types.ID, comments ...*store.Comment) error {
+	var all []*store.Comment
+	var walk func([]*store.Comment)
+	walk = func(cs []*store.Comment) {
+		for _, c := range cs {
+			all = append(all, c)
+			walk(c.Replies)
+		}
+	}
+	walk(comments)
+
+	ids := make([]types.ID, len(all))
+	for i, c := range all {
+		ids[i] = c.ID
+	}
+
+	summaries, err := app.store.Reactions.Summaries(ctx, store.ReactionTargetComment, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range all {
+		c.Reactions = summaries[c.ID]
+	}
+
+	return nil
+}
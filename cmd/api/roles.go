@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateRolePayload struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Level       int      `json:"level"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRolePayload struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Level       *int      `json:"level"`
+	Permissions *[]string `json:"permissions"`
+}
+
+type UpdateUserRolePayload struct {
+	RoleID types.ID `json:"role_id"`
+}
+
+// listRolesHandler godoc
+//
+//	@Summary		Lists roles
+//	@Description	Lists every role with the permissions it grants
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}	store.Role
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [get]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.GetAll(r.Context())
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, roles); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// listPermissionsHandler godoc
+//
+//	@Summary		Lists permissions
+//	@Description	Lists every permission that can be granted to a role
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}	store.Permission
+//	@Security		ApiKeyAuth
+//	@Router			/admin/permissions [get]
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Roles.GetPermissions(r.Context())
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, permissions); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// createRoleHandler godoc
+//
+//	@Summary		Creates a role
+//	@Description	The role may not have a higher level or more permissions than the caller's own role
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateRolePayload	true	"Role"
+//	@Success		201		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [post]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	role := &store.Role{
+		Name:        strings.TrimSpace(payload.Name),
+		Description: payload.Description,
+		Level:       payload.Level,
+		Permissions: payload.Permissions,
+	}
+	if role.Name == "" {
+		pkg.BadRequestError(w, r, errors.New("name is required"))
+		return
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	// nobody creates a role that grants more than their own
+	caller, err := app.getRole(r.Context(), getPrincipalFromContext(r).User.Role.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if outranks(role, caller) {
+		pkg.ForbiddenErrorResponse(w, r)
+		return
+	}
+
+	if err := app.store.Roles.Create(r.Context(), role); err != nil {
+		app.roleError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusCreated, role); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// updateRoleHandler godoc
+//
+//	@Summary		Updates a role
+//	@Description	Changes the given fields of a role. Permissions, when given, replace the current ones. Neither the role nor the result may have a higher level or more permissions than the caller's own role.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleID	path		int					true	"Role ID"
+//	@Param			payload	body		UpdateRolePayload	true	"Fields to change"
+//	@Success		200		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleID} [patch]
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	var payload UpdateRolePayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	stored, err := app.store.Roles.GetByID(ctx, types.ID(id))
+	if err != nil {
+		app.roleError(w, r, err)
+		return
+	}
+
+	role := *stored
+	if payload.Name != nil {
+		role.Name = strings.TrimSpace(*payload.Name)
+		if role.Name == "" {
+			pkg.BadRequestError(w, r, errors.New("name must not be empty"))
+			return
+		}
+	}
+	if payload.Description != nil {
+		role.Description = *payload.Description
+	}
+	if payload.Level != nil {
+		role.Level = *payload.Level
+	}
+	if payload.Permissions != nil {
+		role.Permissions = *payload.Permissions
+		if role.Permissions == nil {
+			role.Permissions = []string{}
+		}
+
+		// without roles.manage on their own role nobody could undo it
+		if role.ID == getPrincipalFromContext(r).User.Role.ID && !role.HasPermission(store.PermissionRolesManage) {
+			pkg.BadRequestError(w, r, errors.New("you cannot remove roles.manage from your own role"))
+			return
+		}
+	}
+
+	// nobody edits a role above their own, or lifts one above it
+	caller, err := app.getRole(ctx, getPrincipalFromContext(r).User.Role.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if outranks(stored, caller) || outranks(&role, caller) {
+		pkg.ForbiddenErrorResponse(w, r)
+		return
+	}
+
+	// nil keeps the current permissions
+	if payload.Permissions == nil {
+		role.Permissions = nil
+	}
+
+	if err := app.store.Roles.Update(ctx, &role); err != nil {
+		app.roleError(w, r, err)
+		return
+	}
+
+	if err := app.cacheStorage.Roles.Delete(ctx, role.ID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	updated, err := app.store.Roles.GetByID(ctx, role.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, updated); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// updateUserRoleHandler godoc
+//
+//	@Summary		Changes the role of a user
+//	@Description	The caller's own role must match both the new and the current role of the user in level and permissions
+//	@Tags			admin
+//	@Accept			json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			payload	body		UpdateUserRolePayload	true	"New role"
+//	@Success		204		{string}	string					"Role changed"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/role [put]
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+	userID := types.ID(id)
+
+	var payload UpdateUserRolePayload
+	if err := pkg.ReadJson(w, r, &payload); err != nil {
+		pkg.BadRequestError(w, r, err)
+		return
+	}
+
+	// an admin demoting themselves could leave nobody able to undo it
+	if userID == getPrincipalFromContext(r).User.ID {
+		pkg.BadRequestError(w, r, errors.New("you cannot change your own role"))
+		return
+	}
+
+	ctx := r.Context()
+	role, err := app.store.Roles.GetByID(ctx, payload.RoleID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.BadRequestError(w, r, errors.New("role does not exist"))
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	caller, err := app.getRole(ctx, getPrincipalFromContext(r).User.Role.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	// nobody hands out, or takes away, more than their own role grants
+	current, err := app.getRole(ctx, user.Role.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+	if outranks(role, caller) || outranks(current, caller) {
+		pkg.ForbiddenErrorResponse(w, r)
+		return
+	}
+
+	if err := app.store.Users.SetRole(ctx, userID, payload.RoleID); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the cached user still carries the old role
+	if err := app.cacheStorage.Users.Delete(ctx, userID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("user role changed", "user_id", userID, "role_id", payload.RoleID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// outranks reports whether role has a higher level than caller or grants a
+// permission caller lacks.
+func outranks(role, caller *store.Role) bool {
+	if role.Level > caller.Level {
+		return true
+	}
+
+	for _, permission := range role.Permissions {
+		if !caller.HasPermission(permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (app *application) roleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		pkg.NotFoundError(w, r, err)
+	case errors.Is(err, store.ErrorConflict):
+		pkg.ConflictErrorResponse(w, r, errors.New("a role with this name already exists"))
+	case errors.Is(err, store.ErrUnknownPermission):
+		pkg.BadRequestError(w, r, err)
+	default:
+		pkg.InternalServerError(w, r, err)
+	}
+}
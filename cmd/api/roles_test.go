@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// The caller holds the moderator role. The admin role outranks it, the
+// editor role is below it.
+var testRoles = map[types.ID]store.Role{
+	1: {ID: 1, Name: "admin", Level: 3, Permissions: []string{store.PermissionRolesManage, store.PermissionUsersRoleUpdate, store.PermissionPostsDeleteAny}},
+	2: {ID: 2, Name: "moderator", Level: 2, Permissions: []string{store.PermissionRolesManage, store.PermissionPostsUpdateAny}},
+	3: {ID: 3, Name: "editor", Level: 1, Permissions: []string{store.PermissionPostsUpdateAny}},
+}
+
+type fakeRoles struct {
+	store.RoleStore
+	saved *store.Role
+}
+
+func (s *fakeRoles) GetByID(ctx context.Context, id types.ID) (*store.Role, error) {
+	role, ok := testRoles[id]
+	if !ok {
+		return nil, store.ErrorNotFound
+	}
+	return &role, nil
+}
+
+func (s *fakeRoles) Create(ctx context.Context, role *store.Role) error {
+	s.saved = role
+	return nil
+}
+
+func (s *fakeRoles) Update(ctx context.Context, role *store.Role) error {
+	s.saved = role
+	return nil
+}
+
+// fakeRoleCache always misses, so roles are read from the store.
+type fakeRoleCache struct{}
+
+func (fakeRoleCache) Get(ctx context.Context, roleID types.ID) (*store.Role, error) {
+	return nil, nil
+}
+
+func (fakeRoleCache) Set(ctx context.Context, role *store.Role) error {
+	return nil
+}
+
+func (fakeRoleCache) Delete(ctx context.Context, roleID types.ID) error {
+	return nil
+}
+
+func newRolesTestServer(t *testing.T, roles *fakeRoles) *httptest.Server {
+	t.Helper()
+
+	app := &application{
+		logger: zap.NewNop().Sugar(),
+		store:  store.Storage{Roles: roles},
+	}
+	app.cacheStorage.Roles = fakeRoleCache{}
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := &Principal{User: &store.User{ID: 10, Role: store.Role{ID: 2}}}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalCtx, principal)))
+		})
+	})
+	r.Post("/admin/roles", app.createRoleHandler)
+	r.Patch("/admin/roles/{roleID}", app.updateRoleHandler)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func sendRoleRequest(t *testing.T, method, url, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestCreateRole(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"creates a role below the caller's", `{"name":"helper","level":1,"permissions":["posts.update.any"]}`, http.StatusCreated},
+		{"creates a role equal to the caller's", `{"name":"co-moderator","level":2,"permissions":["roles.manage","posts.update.any"]}`, http.StatusCreated},
+		{"rejects a higher level", `{"name":"boss","level":3}`, http.StatusForbidden},
+		{"rejects a permission the caller lacks", `{"name":"cleaner","level":1,"permissions":["posts.delete.any"]}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := &fakeRoles{}
+			srv := newRolesTestServer(t, roles)
+
+			if got := sendRoleRequest(t, http.MethodPost, srv.URL+"/admin/roles", tt.body); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+			if saved := roles.saved != nil; saved != (tt.want == http.StatusCreated) {
+				t.Fatalf("role saved = %v", saved)
+			}
+		})
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		roleID string
+		body   string
+		want   int
+	}{
+		{"edits a role below the caller's", "3", `{"description":"edits posts","level":2}`, http.StatusOK},
+		{"edits the caller's own role", "2", `{"description":"moderates"}`, http.StatusOK},
+		{"rejects editing a role above the caller's", "1", `{"description":"less"}`, http.StatusForbidden},
+		{"rejects lowering a role above the caller's", "1", `{"level":1,"permissions":[]}`, http.StatusForbidden},
+		{"rejects raising the level above the caller's", "3", `{"level":3}`, http.StatusForbidden},
+		{"rejects granting a permission the caller lacks", "3", `{"permissions":["posts.update.any","posts.delete.any"]}`, http.StatusForbidden},
+		{"rejects granting the caller's own role more", "2", `{"permissions":["roles.manage","posts.update.any","users.role.update"]}`, http.StatusForbidden},
+		{"rejects removing roles.manage from the caller's own role", "2", `{"permissions":["posts.update.any"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := &fakeRoles{}
+			srv := newRolesTestServer(t, roles)
+
+			if got := sendRoleRequest(t, http.MethodPatch, srv.URL+"/admin/roles/"+tt.roleID, tt.body); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+			if saved := roles.saved != nil; saved != (tt.want == http.StatusOK) {
+				t.Fatalf("role saved = %v", saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxUserAgentLength = 512
+
+type SessionResponse struct {
+	store.Session
+	Current bool `json:"current"`
+}
+
+// listSessionsHandler godoc
+//
+//	@Summary		Lists sessions
+//	@Description	Lists the devices the caller is logged in on. The session of the request is marked as current.
+//	@Tags			sessions
+//	@Produce		json
+//	@Success		200	{array}	SessionResponse
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions [get]
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal := getPrincipalFromContext(r)
+
+	sessions, err := app.store.Sessions.GetByUserID(r.Context(), principal.User.ID)
+	if err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	resp := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = SessionResponse{
+			Session: session,
+			Current: session.ID == principal.Claims.SessionID,
+		}
+	}
+
+	if err := pkg.JsonResponse(w, http.StatusOK, resp); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+}
+
+// revokeSessionHandler godoc
+//
+//	@Summary		Revokes a session
+//	@Description	Logs the device of the session out. Its tokens stop working immediately.
+//	@Tags			sessions
+//	@Param			sessionID	path		string	true	"Session ID"
+//	@Success		204			{string}	string	"Session revoked"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions/{sessionID} [delete]
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := getPrincipalFromContext(r).User.ID
+
+	err := app.store.Sessions.Revoke(r.Context(), userID, chi.URLParam(r, "sessionID"))
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			pkg.NotFoundError(w, r, err)
+		default:
+			pkg.InternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeOtherSessionsHandler godoc
+//
+//	@Summary		Revokes all other sessions
+//	@Description	Logs out every device except the one making the request
+//	@Tags			sessions
+//	@Success		204	{string}	string	"Other sessions revoked"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions [delete]
+func (app *application) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal := getPrincipalFromContext(r)
+
+	if err := app.store.Sessions.RevokeOthers(r.Context(), principal.User.ID, principal.Claims.SessionID); err != nil {
+		pkg.InternalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newSession describes the device a login request comes from.
+func newSession(r *http.Request, user *store.User) *store.Session {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return &store.Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+}
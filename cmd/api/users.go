@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/MohammadBohluli/social-app-go/types"
@@ -15,7 +16,27 @@ import (
 
 type userKey string
 
-const userCtx userKey = "user"
+const (
+	userCtx      userKey = "user"
+	principalCtx userKey = "principal"
+)
+
+// Principal is the authenticated caller of a request, set by AuthTokenMiddleware.
+// Exactly one of Claims and APIKey is set, depending on how the caller
+// authenticated.
+type Principal struct {
+	User   *store.User
+	Claims *auth.Claims
+	APIKey *store.APIKey
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.APIKey != nil {
+		return p.APIKey.HasScope(scope)
+	}
+
+	return true
+}
 
 type FollowUserRequest struct {
 	UserID types.ID `json:"user_id"`
@@ -101,7 +122,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
 func (app application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
+	followerUser := getPrincipalFromContext(r).User
 	followedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		pkg.BadRequestError(w, r, err)
@@ -137,7 +158,7 @@ func (app application) followUserHandler(w http.ResponseWriter, r *http.Request)
 //	@Router			/users/{userID}/unfollow [put]
 func (app application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 
-	followerUser := getUserFromContext(r)
+	followerUser := getPrincipalFromContext(r).User
 	unfollowedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		pkg.BadRequestError(w, r, err)
@@ -185,7 +206,7 @@ func (app application) userContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func getUserFromContext(r *http.Request) *store.User {
-	user, _ := r.Context().Value(userCtx).(*store.User)
-	return user
+func getPrincipalFromContext(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalCtx).(*Principal)
+	return principal
 }
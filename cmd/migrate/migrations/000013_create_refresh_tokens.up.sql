@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+    "id" bigserial PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "family_id" UUID NOT NULL,
+    "token_hash" bytea UNIQUE NOT NULL,
+    "expiry" TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    "revoked_at" TIMESTAMP(0) WITH TIME ZONE,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
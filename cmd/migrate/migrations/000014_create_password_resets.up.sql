@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS password_resets(
+    "token_hash" bytea PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "expiry" TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    "used_at" TIMESTAMP(0) WITH TIME ZONE,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS user_invitations(
+    "token" bytea PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "expiry" TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS password_resets(
+    "token_hash" bytea PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "expiry" TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    "used_at" TIMESTAMP(0) WITH TIME ZONE,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+
+INSERT INTO password_resets (token_hash, user_id, expiry, used_at, created_at)
+SELECT hash, user_id, expiry, used_at, created_at FROM tokens WHERE purpose = 'password_reset';
+
+-- activation tokens are one-way hashes and can't be turned back into
+-- invitation tokens, so pending invitations are lost
+
+DROP TABLE IF EXISTS tokens;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS tokens(
+    "hash" bytea PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "purpose" VARCHAR(50) NOT NULL,
+    "expiry" TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    "used_at" TIMESTAMP(0) WITH TIME ZONE,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id_purpose ON tokens (user_id, purpose);
+
+-- invitation links carry the hex encoded hash that used to be stored, so that
+-- string is now the plaintext and its SHA-256 is what we keep
+INSERT INTO tokens (hash, user_id, purpose, expiry)
+SELECT sha256(token), user_id, 'activation', expiry FROM user_invitations
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tokens (hash, user_id, purpose, expiry, used_at, created_at)
+SELECT token_hash, user_id, 'password_reset', expiry, used_at, created_at FROM password_resets
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS user_invitations;
+
+DROP TABLE IF EXISTS password_resets;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS user_mfa(
+    "user_id" BIGINT PRIMARY KEY,
+    "secret" bytea NOT NULL,
+    "confirmed_at" TIMESTAMP(0) WITH TIME ZONE,
+    "last_used_step" BIGINT NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+    "id" bigserial PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "code_hash" bytea NOT NULL,
+    "used_at" TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+    "id" bigserial PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "prefix" VARCHAR(32) UNIQUE NOT NULL,
+    "key_hash" bytea UNIQUE NOT NULL,
+    "scopes" VARCHAR(50) [] NOT NULL DEFAULT '{}',
+    "expires_at" TIMESTAMP(0) WITH TIME ZONE,
+    "last_used_at" TIMESTAMP(0) WITH TIME ZONE,
+    "revoked_at" TIMESTAMP(0) WITH TIME ZONE,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
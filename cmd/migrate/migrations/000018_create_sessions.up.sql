@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS sessions(
+    "id" UUID PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "user_agent" TEXT NOT NULL DEFAULT '',
+    "ip" VARCHAR(45) NOT NULL DEFAULT '',
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "last_seen_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "revoked_at" TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+-- every refresh token family becomes a session
+INSERT INTO sessions (id, user_id, created_at, last_seen_at, revoked_at)
+SELECT
+    family_id,
+    MIN(user_id),
+    MIN(created_at),
+    MAX(created_at),
+    CASE WHEN BOOL_AND(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id;
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT fk_refresh_tokens_session FOREIGN KEY (family_id) REFERENCES sessions (id) ON DELETE CASCADE;
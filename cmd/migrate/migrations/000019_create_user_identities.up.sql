@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_identities(
+    "id" bigserial PRIMARY KEY,
+    "user_id" BIGINT NOT NULL,
+    "provider" VARCHAR(50) NOT NULL,
+    "subject" VARCHAR(255) NOT NULL,
+    "email" citext,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE,
+    UNIQUE ("provider", "subject")
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
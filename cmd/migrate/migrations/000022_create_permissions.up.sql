@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS permissions(
+    "id" BIGSERIAL PRIMARY KEY,
+    "name" VARCHAR(255) NOT NULL UNIQUE,
+    "description" TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+    "role_id" BIGINT NOT NULL,
+    "permission_id" BIGINT NOT NULL,
+
+    PRIMARY KEY ("role_id", "permission_id"),
+    FOREIGN KEY ("role_id") REFERENCES roles ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("permission_id") REFERENCES permissions ("id") ON DELETE CASCADE
+);
+
+INSERT INTO
+    permissions (name, description)
+VALUES
+    ('posts.update.any', 'update posts of other users'),
+    ('posts.delete.any', 'delete posts of other users'),
+    ('roles.manage', 'create and edit roles and their permissions'),
+    ('users.role.update', 'change the role of a user');
+
+-- keep what the role levels allowed before
+INSERT INTO
+    role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'moderator' AND permissions.name = 'posts.update.any')
+    OR roles.name = 'admin';
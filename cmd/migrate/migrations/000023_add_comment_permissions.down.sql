@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+DELETE FROM permissions WHERE name IN ('comments.update.any', 'comments.delete.any');
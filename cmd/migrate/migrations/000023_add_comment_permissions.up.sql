@@ -0,0 +1,14 @@
+INSERT INTO
+    permissions (name, description)
+VALUES
+    ('comments.update.any', 'update comments of other users'),
+    ('comments.delete.any', 'delete comments of other users');
+
+INSERT INTO
+    role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name IN ('moderator', 'admin')
+    AND permissions.name IN ('comments.update.any', 'comments.delete.any');
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_created_at ON comments (post_id, created_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+ALTER TABLE comments
+DROP CONSTRAINT IF EXISTS fk_comments_parent,
+DROP COLUMN IF EXISTS deleted_at,
+DROP COLUMN IF EXISTS depth,
+DROP COLUMN IF EXISTS parent_id;
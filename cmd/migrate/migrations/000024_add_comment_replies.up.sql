@@ -0,0 +1,11 @@
+ALTER TABLE comments
+ADD COLUMN parent_id BIGINT,
+ADD COLUMN depth INT NOT NULL DEFAULT 0,
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- removing a comment outright removes its replies with it; the API instead
+-- keeps a placeholder while replies exist
+ALTER TABLE comments
+ADD CONSTRAINT fk_comments_parent FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at);
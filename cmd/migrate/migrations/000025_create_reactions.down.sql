@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_comments_delete_reactions ON comments;
+DROP TRIGGER IF EXISTS trg_posts_delete_reactions ON posts;
+DROP FUNCTION IF EXISTS delete_target_reactions;
+DROP TABLE IF EXISTS reactions;
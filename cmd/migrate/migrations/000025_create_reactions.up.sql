@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS reactions(
+    "user_id" BIGINT NOT NULL,
+    "target_type" VARCHAR(20) NOT NULL,
+    "target_id" BIGINT NOT NULL,
+    "reaction" VARCHAR(32) NOT NULL,
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY ("user_id", "target_type", "target_id", "reaction"),
+    FOREIGN KEY ("user_id") REFERENCES users ("id") ON DELETE CASCADE,
+    CHECK ("target_type" IN ('post', 'comment'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions (target_type, target_id);
+
+-- reactions point at posts or comments by type, so no foreign key can remove
+-- them along with their target
+CREATE OR REPLACE FUNCTION delete_target_reactions() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM reactions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_posts_delete_reactions
+    AFTER DELETE ON posts
+    FOR EACH ROW EXECUTE FUNCTION delete_target_reactions('post');
+
+CREATE TRIGGER trg_comments_delete_reactions
+    AFTER DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION delete_target_reactions('comment');
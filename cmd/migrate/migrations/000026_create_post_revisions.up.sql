@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS post_revisions(
+    "post_id" BIGINT NOT NULL,
+    "version" INT NOT NULL,
+    "editor_id" BIGINT,
+    "title" TEXT NOT NULL,
+    "content" TEXT NOT NULL,
+    "tags" VARCHAR(100) [],
+    "created_at" TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY ("post_id", "version"),
+    FOREIGN KEY ("post_id") REFERENCES posts ("id") ON DELETE CASCADE,
+    FOREIGN KEY ("editor_id") REFERENCES users ("id") ON DELETE SET NULL
+);
+
+-- existing posts start their history at the version they are at; only the
+-- author can have written an unedited post
+INSERT INTO post_revisions ("post_id", "version", "editor_id", "title", "content", "tags", "created_at")
+SELECT "id", COALESCE("version", 0), CASE WHEN COALESCE("version", 0) = 0 THEN "user_id" END, "title", "content", "tags", "updated_at"
+FROM posts
+ON CONFLICT DO NOTHING;
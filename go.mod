@@ -16,6 +16,7 @@ require (
 	github.com/sendgrid/rest v2.6.9+incompatible // indirect
 	github.com/swaggo/files/v2 v2.0.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
 
 require (
@@ -32,5 +33,5 @@ require (
 	github.com/swaggo/swag v1.16.4
 	golang.org/x/crypto v0.33.0
 	golang.org/x/tools v0.30.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one RSA or Ed25519 key pair known to the authenticator. Keys
+// loaded from a public key file can only verify tokens.
+type SigningKey struct {
+	ID      string
+	Retired bool
+
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// LoadSigningKey reads a PEM file holding a PKCS#8 or PKCS#1 private key, or a
+// PKIX public key.
+func LoadSigningKey(id, path string, retired bool) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", id, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found in %s", id, path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	key := &SigningKey{ID: id, Retired: retired}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, k.Public()
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+
+	return key, nil
+}
+
+// AsymmetricAuthenticator signs tokens with the active key and stamps its id
+// in the kid header. Tokens signed by any other non-retired key still verify,
+// which lets keys be rotated without logging everyone out.
+type AsymmetricAuthenticator struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	aud    string
+	iss    string
+}
+
+func NewAsymmetricAuthenticator(keys []*SigningKey, activeID, aud, iss string) (*AsymmetricAuthenticator, error) {
+	a := &AsymmetricAuthenticator{
+		keys: make(map[string]*SigningKey, len(keys)),
+		aud:  aud,
+		iss:  iss,
+	}
+
+	for _, key := range keys {
+		if _, ok := a.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		a.keys[key.ID] = key
+	}
+
+	active, ok := a.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeID)
+	}
+	if active.Retired || active.private == nil {
+		return nil, fmt.Errorf("active key %q must be a non-retired private key", activeID)
+	}
+	a.active = active
+
+	return a, nil
+}
+
+func (a *AsymmetricAuthenticator) GenerateToken(claims *Claims) (string, error) {
+	claims.fill(a.iss, a.aud)
+
+	token := jwt.NewWithClaims(a.active.method, claims)
+	token.Header["kid"] = a.active.ID
+
+	tokenString, err := token.SignedString(a.active.private)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func (a *AsymmetricAuthenticator) ValidateToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok || key.Retired {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected singing method %v for key %q", t.Header["alg"], kid)
+		}
+
+		return key.public, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// JWKS publishes the public half of every non-retired key.
+func (a *AsymmetricAuthenticator) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range a.keys {
+		if key.Retired {
+			continue
+		}
+
+		jwk, err := key.jwk()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k *SigningKey) jwk() (JWK, error) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, errors.New("unsupported public key type")
+	}
+
+	return jwk, nil
+}
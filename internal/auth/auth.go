@@ -1,8 +1,14 @@
 package auth
 
-import "github.com/golang-jwt/jwt/v5"
-
 type Authenticator interface {
-	GenerateToken(claims jwt.Claims) (string, error)
-	ValidateToken(token string) (*jwt.Token, error)
+	// GenerateToken fills in the issuer, audience and jti when they are
+	// missing and signs the claims.
+	GenerateToken(claims *Claims) (string, error)
+	ValidateToken(token string) (*Claims, error)
+}
+
+// KeySetProvider is implemented by authenticators whose verification keys can
+// be shared with other services.
+type KeySetProvider interface {
+	JWKS() JWKS
 }
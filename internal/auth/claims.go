@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ScopeMFAPending marks a token that only proves the password was right. It
+// can be exchanged for a real token with a TOTP or recovery code and is
+// refused everywhere else.
+const ScopeMFAPending = "mfa:pending"
+
+// Claims are the claims carried by every access token we issue.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role      string   `json:"role,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+}
+
+func NewClaims(userID types.ID, role string) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatInt(int64(userID), 10),
+		},
+		Role: role,
+	}
+}
+
+func (c *Claims) fill(iss, aud string) {
+	if c.Issuer == "" {
+		c.Issuer = iss
+	}
+	if len(c.Audience) == 0 {
+		c.Audience = jwt.ClaimStrings{aud}
+	}
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+}
+
+// UserID returns the subject as a user id.
+func (c *Claims) UserID() (types.ID, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("token subject is not a user id")
+	}
+
+	return types.ID(id), nil
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate is called by the jwt parser after the registered claims have been
+// checked, so a token that reaches a handler always has these fields.
+func (c *Claims) Validate() error {
+	if _, err := c.UserID(); err != nil {
+		return err
+	}
+
+	if c.ID == "" {
+		return errors.New("token has no jti")
+	}
+
+	if c.IssuedAt == nil {
+		return errors.New("token has no iat")
+	}
+
+	return nil
+}
@@ -20,7 +20,9 @@ func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
 	}
 }
 
-func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+func (a *JWTAuthenticator) GenerateToken(claims *Claims) (string, error) {
+	claims.fill(a.iss, a.aud)
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(a.secret))
@@ -31,9 +33,10 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 	return tokenString, nil
 }
 
-func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+func (a *JWTAuthenticator) ValidateToken(token string) (*Claims, error) {
 
-	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected singing method %v", t.Header["alg"])
 		}
@@ -42,7 +45,12 @@ func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 	},
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
-		jwt.WithIssuer(a.aud),
+		jwt.WithIssuer(a.iss),
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
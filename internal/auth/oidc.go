@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrOIDCCodeRejected is returned when the provider refuses to exchange an
+	// authorization code, e.g. because it was already used or has expired.
+	ErrOIDCCodeRejected = errors.New("oidc: authorization code was rejected")
+	// ErrOIDCInvalidIDToken is returned when the provider's id token does not verify.
+	ErrOIDCInvalidIDToken = errors.New("oidc: invalid id token")
+)
+
+const maxOIDCResponseSize = 1 << 20
+
+type OIDCProviderOptions struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// The endpoints are discovered from the issuer unless all three are set.
+	AuthURL  string
+	TokenURL string
+	JWKSURL  string
+}
+
+// OIDCIdentity is what a verified id token tells us about the user.
+type OIDCIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// OIDCProvider is an OpenID Connect relying party for one identity provider,
+// using the authorization code flow with PKCE.
+type OIDCProvider struct {
+	Name string
+
+	opts   OIDCProviderOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type oidcEndpoints struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+type oidcClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func NewOIDCProvider(opts OIDCProviderOptions) *OIDCProvider {
+	if len(opts.Scopes) == 0 {
+		opts.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	p := &OIDCProvider{
+		Name:   opts.Name,
+		opts:   opts,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if opts.AuthURL != "" && opts.TokenURL != "" && opts.JWKSURL != "" {
+		p.endpoints = &oidcEndpoints{
+			Issuer:   opts.Issuer,
+			AuthURL:  opts.AuthURL,
+			TokenURL: opts.TokenURL,
+			JWKSURL:  opts.JWKSURL,
+		}
+	}
+
+	return p
+}
+
+// NewPKCE returns a code verifier and its S256 code challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, _, err = NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL is where the user is sent to log in at the provider.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(endpoints.AuthURL)
+	if err != nil {
+		return "", fmt.Errorf("oidc: authorization endpoint: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.opts.ClientID)
+	q.Set("redirect_uri", p.opts.RedirectURL)
+	q.Set("scope", strings.Join(p.opts.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and verifies the id token that comes
+// back, including that it carries nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.opts.RedirectURL)
+	form.Set("client_id", p.opts.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+
+	var resp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.do(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case status >= 400 && status < 500:
+		return nil, fmt.Errorf("%w: %s %s", ErrOIDCCodeRejected, resp.Error, resp.ErrorDescription)
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("oidc: token endpoint returned %d", status)
+	case resp.IDToken == "":
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrOIDCInvalidIDToken)
+	}
+
+	return p.verify(ctx, endpoints, resp.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verify(ctx context.Context, endpoints *oidcEndpoints, idToken, nonce string) (*OIDCIdentity, error) {
+	claims := &oidcClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, endpoints, kid)
+	},
+		jwt.WithIssuer(endpoints.Issuer),
+		jwt.WithAudience(p.opts.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCInvalidIDToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidIDToken)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrOIDCInvalidIDToken)
+	}
+
+	return &OIDCIdentity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// discover fetches the provider metadata once and caches it. Failures are not
+// cached, so a provider that is down at startup is retried on the next login.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.opts.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := &oidcEndpoints{}
+	status, err := p.do(req, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery for %s returned %d", p.Name, status)
+	}
+
+	if endpoints.Issuer != p.opts.Issuer {
+		return nil, fmt.Errorf("oidc: provider %s reports issuer %q, expected %q", p.Name, endpoints.Issuer, p.opts.Issuer)
+	}
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" || endpoints.JWKSURL == "" {
+		return nil, fmt.Errorf("oidc: discovery for %s is missing endpoints", p.Name)
+	}
+
+	p.endpoints = endpoints
+	return endpoints, nil
+}
+
+// key returns the provider's signing key with the given id, fetching the key
+// set again when the id is unknown so provider key rotation is picked up.
+func (p *OIDCProvider) key(ctx context.Context, endpoints *oidcEndpoints, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	// forged kids must not turn every request into a fetch from the provider
+	if time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("oidc: unknown key id %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set JWKS
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: key set for %s returned %d", p.Name, status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown key id %q", kid)
+	}
+
+	return key, nil
+}
+
+// do sends req and decodes the JSON body into dst, whatever the status.
+func (p *OIDCProvider) do(req *http.Request, dst any) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxOIDCResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+
+	if err := json.Unmarshal(body, dst); err != nil && res.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("oidc: decoding %s: %w", req.URL, err)
+	}
+
+	return res.StatusCode, nil
+}
+
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random token for the client and the SHA-256 hash
+// that is stored server side.
+func NewOpaqueToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	plain := base64.RawURLEncoding.EncodeToString(b)
+	return plain, HashOpaqueToken(plain), nil
+}
+
+func HashOpaqueToken(plain string) []byte {
+	hash := sha256.Sum256([]byte(plain))
+	return hash[:]
+}
+
+// NewAPIKey returns a key of the form gs_<prefix>_<secret>. The prefix is
+// stored in clear so users can tell their keys apart; only the hash of the
+// whole key is stored.
+func NewAPIKey() (key, prefix string, hash []byte, err error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", nil, err
+	}
+
+	secret, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	prefix = "gs_" + hex.EncodeToString(b)
+	key = prefix + "_" + secret
+
+	return key, prefix, HashOpaqueToken(key), nil
+}
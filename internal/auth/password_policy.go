@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minIdentityLength keeps short usernames like "al" from banning half of all passwords.
+const minIdentityLength = 3
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BanIdentity rejects passwords containing the username or the local part
+	// of the email.
+	BanIdentity bool
+	// Breached is optional; nil skips the breach check.
+	Breached *BreachedPasswords
+}
+
+// Check returns every rule the password breaks, as messages fit for the
+// user. An empty result means the password is acceptable.
+func (p *PasswordPolicy) Check(password, username, email string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if p.BanIdentity {
+		lowered := strings.ToLower(password)
+		local, _, _ := strings.Cut(email, "@")
+		for _, banned := range []string{username, local} {
+			banned = strings.ToLower(banned)
+			if len(banned) >= minIdentityLength && strings.Contains(lowered, banned) {
+				problems = append(problems, "must not contain your username or email")
+				break
+			}
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		problems = append(problems, "has appeared in a data breach, choose another one")
+	}
+
+	return problems
+}
+
+// BreachedPasswords is an in-memory set of SHA-1 prefixes of breached
+// passwords, searched without any network access.
+type BreachedPasswords struct {
+	// prefixes holds size-byte entries back to back, in ascending order.
+	prefixes []byte
+	size     int
+}
+
+// LoadBreachedPasswords reads a file with one hex encoded SHA-1 prefix per
+// line, sorted in ascending order. All prefixes must have the same even
+// length. Anything after a colon, such as the HIBP occurrence count, is
+// ignored, as are blank lines.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &BreachedPasswords{}
+	var prev []byte
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ":")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		prefix, err := hex.DecodeString(text)
+		if err != nil || len(prefix) == 0 || len(prefix) > sha1.Size {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 prefix", path, line)
+		}
+
+		if b.size == 0 {
+			b.size = len(prefix)
+		} else if len(prefix) != b.size {
+			return nil, fmt.Errorf("%s:%d: prefix has %d bytes, want %d", path, line, len(prefix), b.size)
+		}
+
+		if prev != nil && bytes.Compare(prev, prefix) > 0 {
+			return nil, fmt.Errorf("%s:%d: prefixes are not sorted", path, line)
+		}
+
+		b.prefixes = append(b.prefixes, prefix...)
+		prev = b.prefixes[len(b.prefixes)-b.size:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Len returns the number of prefixes in the set.
+func (b *BreachedPasswords) Len() int {
+	if b.size == 0 {
+		return 0
+	}
+
+	return len(b.prefixes) / b.size
+}
+
+// Contains reports whether the password's SHA-1 starts with a listed prefix.
+func (b *BreachedPasswords) Contains(password string) bool {
+	n := b.Len()
+	if n == 0 {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	key := sum[:b.size]
+
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(b.prefixes[i*b.size:(i+1)*b.size], key) >= 0
+	})
+
+	return i < n && bytes.Equal(b.prefixes[i*b.size:(i+1)*b.size], key)
+}
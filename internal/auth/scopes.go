@@ -0,0 +1,27 @@
+package auth
+
+// Scopes that can be granted to API keys. Tokens issued by a user login carry
+// no scopes and may do everything the user can.
+const (
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsRead  = "comments:read"
+	ScopeCommentsWrite = "comments:write"
+	ScopeFeedRead      = "feed:read"
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+)
+
+var apiKeyScopes = map[string]bool{
+	ScopePostsRead:     true,
+	ScopePostsWrite:    true,
+	ScopeCommentsRead:  true,
+	ScopeCommentsWrite: true,
+	ScopeFeedRead:      true,
+	ScopeUsersRead:     true,
+	ScopeUsersWrite:    true,
+}
+
+func IsAPIKeyScope(scope string) bool {
+	return apiKeyScopes[scope]
+}
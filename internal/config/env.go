@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(v)
+	}
+	return fallback
+}
+
+func getInt(key string, dst *int) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	*dst = i
+	return nil
+}
+
+func getBool(key string, dst *bool) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	*dst = b
+	return nil
+}
+
+func getDuration(key string, dst *time.Duration) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	*dst = d
+	return nil
+}
+
+// getKeys parses a comma separated list of id=path pairs. Keys set this way
+// replace the ones from the config file; retiring a key means dropping it.
+func getKeys(key string, dst *[]KeyConfig) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+
+	var keys []KeyConfig
+	for _, pair := range strings.Split(v, ",") {
+		id, path, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return fmt.Errorf("%s: expected id=path, got %q", key, pair)
+		}
+		keys = append(keys, KeyConfig{ID: id, Path: path})
+	}
+
+	*dst = keys
+	return nil
+}
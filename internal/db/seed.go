@@ -9,6 +9,7 @@ import (
 	"math/rand/v2"
 
 	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/pkg"
 )
 
 var usernames = []string{
@@ -104,7 +105,13 @@ func Seed(s store.Storage, db *sql.DB) {
 	ctx := context.Background()
 	tx, _ := db.BeginTx(ctx, nil)
 
-	users := generateUsers(10)
+	password, err := pkg.NewArgon2idHasher(pkg.DefaultArgon2idParams).Hash("123456")
+	if err != nil {
+		log.Println("❌Error hashing seed password: ", err)
+		return
+	}
+
+	users := generateUsers(10, password)
 	for _, user := range users {
 		if err := s.Users.Create(ctx, tx, user); err != nil {
 			_ = tx.Rollback()
@@ -126,7 +133,7 @@ func Seed(s store.Storage, db *sql.DB) {
 
 	comments := generateComments(50, users, posts)
 	for _, comment := range comments {
-		if err := s.Comments.Create(ctx, *comment); err != nil {
+		if err := s.Comments.Create(ctx, comment); err != nil {
 			log.Println("❌Error creating comment seed: ", err)
 			return
 		}
@@ -136,13 +143,13 @@ func Seed(s store.Storage, db *sql.DB) {
 
 }
 
-func generateUsers(num int) []*store.User {
+func generateUsers(num int, password string) []*store.User {
 	users := make([]*store.User, num)
 	for i := 0; i < num; i++ {
 		users[i] = &store.User{
 			Username: usernames[i%len(usernames)] + fmt.Sprintf("%d", i),
 			Email:    usernames[i%len(usernames)] + fmt.Sprintf("%d", i) + "@example.com",
-			Password: "123456",
+			Password: password,
 			Role: store.Role{
 				Name: "user",
 			},
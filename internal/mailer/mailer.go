@@ -3,9 +3,14 @@ package mailer
 import "embed"
 
 const (
-	FromName             = "GopherSocial"
-	maxRetires           = 3
-	UserWellcomeTemplate = "user_invitation.tmpl"
+	FromName                  = "GopherSocial"
+	maxRetires                = 3
+	UserWellcomeTemplate      = "user_invitation.tmpl"
+	PasswordResetTemplate     = "password_reset.tmpl"
+	MagicLinkTemplate         = "magic_link.tmpl"
+	EmailChangeTemplate       = "email_change.tmpl"
+	EmailChangeNoticeTemplate = "email_change_notice.tmpl"
+	AccountDeletionTemplate   = "account_deletion.tmpl"
 )
 
 //go:embed "templates"
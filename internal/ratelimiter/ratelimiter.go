@@ -7,7 +7,7 @@ type Limiter interface {
 }
 
 type Config struct {
-	RequestsPerTimeFrame int
-	TimeFrame            time.Duration
-	Enabled              bool
+	RequestsPerTimeFrame int           `yaml:"requests_per_time_frame" json:"requests_per_time_frame"`
+	TimeFrame            time.Duration `yaml:"time_frame" json:"time_frame"`
+	Enabled              bool          `yaml:"enabled" json:"enabled"`
 }
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/lib/pq"
+)
+
+type APIKey struct {
+	ID         types.ID   `json:"id"`
+	UserID     types.ID   `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+func (s APIKeyStore) Create(ctx context.Context, key *APIKey, hash []byte) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at;
+	`
+
+	err := s.db.
+		QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByHash returns a key that is neither revoked nor expired.
+func (s APIKeyStore) GetByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2);
+	`
+
+	key := &APIKey{}
+	err := s.db.QueryRowContext(ctx, query, hash, time.Now()).
+		Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+			&key.CreatedAt,
+		)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+func (s APIKeyStore) GetByUserID(ctx context.Context, userID types.ID) ([]APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.RevokedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s APIKeyStore) Revoke(ctx context.Context, userID, keyID types.ID) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;`
+
+	res, err := s.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s APIKeyStore) revokeAllForUser(ctx context.Context, tx *sql.Tx, userID types.ID) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;`
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Touch records that the key was used. Writes are skipped while the last
+// recorded use is younger than a minute.
+func (s APIKeyStore) Touch(ctx context.Context, keyID types.ID) error {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+	`
+
+	_, err := s.db.ExecContext(ctx, query, keyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OIDCState is what we remember about a login started at an identity
+// provider, keyed by the state parameter sent along.
+type OIDCState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+}
+
+type OIDCStateStore struct {
+	rdb *redis.Client
+}
+
+func (s OIDCStateStore) Set(ctx context.Context, state string, data *OIDCState, ttl time.Duration) error {
+	cacheKey := fmt.Sprintf("oidc-state-%s", state)
+
+	json, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, cacheKey, json, ttl).Err()
+}
+
+// Take returns and deletes the state, so each one can be redeemed only once.
+// It returns nil when the state is unknown or expired.
+func (s OIDCStateStore) Take(ctx context.Context, state string) (*OIDCState, error) {
+	cacheKey := fmt.Sprintf("oidc-state-%s", state)
+
+	data, err := s.rdb.GetDel(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var st OIDCState
+	if err := json.Unmarshal([]byte(data), &st); err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
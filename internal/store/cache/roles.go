@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/store"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// RoleStore caches roles with their permissions, which every permission
+// check needs. Entries are dropped when an admin edits the role.
+type RoleStore struct {
+	rdb *redis.Client
+}
+
+const ROLE_EXP_TIME = time.Minute * 10
+
+func (s RoleStore) Get(ctx context.Context, roleID types.ID) (*store.Role, error) {
+	cacheKey := fmt.Sprintf("role-%v", roleID)
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var role store.Role
+	if err := json.Unmarshal([]byte(data), &role); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (s RoleStore) Set(ctx context.Context, role *store.Role) error {
+	cacheKey := fmt.Sprintf("role-%v", role.ID)
+
+	json, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, cacheKey, json, ROLE_EXP_TIME).Err()
+}
+
+func (s RoleStore) Delete(ctx context.Context, roleID types.ID) error {
+	cacheKey := fmt.Sprintf("role-%v", roleID)
+
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/MohammadBohluli/social-app-go/internal/store"
 	"github.com/MohammadBohluli/social-app-go/types"
@@ -12,12 +13,33 @@ type Storage struct {
 	Users interface {
 		Get(ctx context.Context, userID types.ID) (*store.User, error)
 		Set(ctx context.Context, user *store.User) error
+		Delete(ctx context.Context, userID types.ID) error
+	}
+
+	Roles interface {
+		Get(ctx context.Context, roleID types.ID) (*store.Role, error)
+		Set(ctx context.Context, role *store.Role) error
+		Delete(ctx context.Context, roleID types.ID) error
+	}
+
+	Tokens interface {
+		Deny(ctx context.Context, jti string, ttl time.Duration) error
+		IsDenied(ctx context.Context, jti string) (bool, error)
+		CountFailure(ctx context.Context, jti string, ttl time.Duration) (int64, error)
+	}
+
+	OIDCStates interface {
+		Set(ctx context.Context, state string, data *OIDCState, ttl time.Duration) error
+		Take(ctx context.Context, state string) (*OIDCState, error)
 	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
 
-		Users: &UserStore{rdb: rdb},
+		Users:      &UserStore{rdb: rdb},
+		Roles:      &RoleStore{rdb: rdb},
+		Tokens:     &TokenStore{rdb: rdb},
+		OIDCStates: &OIDCStateStore{rdb: rdb},
 	}
 }
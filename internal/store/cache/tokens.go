@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenStore keeps the jti of revoked access tokens until they would have
+// expired anyway.
+type TokenStore struct {
+	rdb *redis.Client
+}
+
+func (s TokenStore) Deny(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	cacheKey := fmt.Sprintf("denied-jti-%s", jti)
+
+	return s.rdb.SetEx(ctx, cacheKey, 1, ttl).Err()
+}
+
+func (s TokenStore) IsDenied(ctx context.Context, jti string) (bool, error) {
+	cacheKey := fmt.Sprintf("denied-jti-%s", jti)
+
+	n, err := s.rdb.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// CountFailure counts a failed use of the token with the given jti and returns
+// the count so far. The count is kept for ttl after the first failure.
+func (s TokenStore) CountFailure(ctx context.Context, jti string, ttl time.Duration) (int64, error) {
+	cacheKey := fmt.Sprintf("failed-jti-%s", jti)
+
+	n, err := s.rdb.Incr(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 1 && ttl > 0 {
+		if err := s.rdb.Expire(ctx, cacheKey, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
@@ -48,3 +48,9 @@ func (s UserStore) Set(ctx context.Context, user *store.User) error {
 
 	return s.rdb.SetEx(ctx, cacheKey, json, USER_EXP_TIME).Err()
 }
+
+func (s UserStore) Delete(ctx context.Context, userID types.ID) error {
+	cacheKey := fmt.Sprintf("user-%v", userID)
+
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
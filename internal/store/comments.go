@@ -3,73 +3,314 @@ package store
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/MohammadBohluli/social-app-go/types"
 )
 
+// DeletedCommentContent replaces the content of a deleted comment that is
+// kept because it still has replies.
+const DeletedCommentContent = "[deleted]"
+
 type Comment struct {
-	ID        types.ID `json:"id"`
-	PostID    types.ID `json:"post_id"`
-	UserID    types.ID `json:"user_id"`
-	Content   string   `json:"content"`
-	CreatedAt string   `json:"created_at"`
-	UpdatedAt string   `json:"updated_at"`
-	User      User     `json:"user"`
+	ID         types.ID   `json:"id"`
+	PostID     types.ID   `json:"post_id"`
+	ParentID   *types.ID  `json:"parent_id"`
+	Depth      int        `json:"depth"`
+	UserID     types.ID   `json:"user_id"`
+	Content    string     `json:"content"`
+	CreatedAt  string     `json:"created_at"`
+	UpdatedAt  string     `json:"updated_at"`
+	Deleted    bool       `json:"deleted"`
+	ReplyCount int        `json:"reply_count"`
+	User       User       `json:"user"`
+	Replies    []*Comment `json:"replies,omitempty"`
+
+	Reactions ReactionSummary `json:"reactions"`
+}
+
+// CommentTreeQuery pages through a comment tree branch by branch: Limit and
+// Offset select the top comments of the branch, and every comment below them
+// shows at most Replies of its own replies. ReplyCount tells which branches
+// have more to fetch.
+type CommentTreeQuery struct {
+	Limit   int
+	Offset  int
+	Replies int
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s CommentStore) GetByPostID(ctx context.Context, postID types.ID) ([]Comment, error) {
+// commentColumns selects a comment as scanned by scanComment. It expects the
+// comment aliased c and users left joined, since deleted comments may outlive
+// their author.
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.updated_at, c.deleted_at,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
+	COALESCE(users.username, '')
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row rowScanner, c *Comment) error {
+	var deletedAt *time.Time
+	err := row.Scan(
+		&c.ID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Depth,
+		&c.UserID,
+		&c.Content,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&deletedAt,
+		&c.ReplyCount,
+		&c.User.Username,
+	)
+	if err != nil {
+		return err
+	}
+
+	c.User.ID = c.UserID
+	if deletedAt != nil {
+		c.Deleted = true
+		c.Content = DeletedCommentContent
+		c.UserID = 0
+		c.User = User{}
+	}
+
+	return nil
+}
+
+// ListByPostID returns one page of the comments on a post, oldest first
+// unless p.Sort is "desc".
+func (s CommentStore) ListByPostID(ctx context.Context, postID types.ID, p pkg.PaginationQuery) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c
-		JOIN users ON users.id = c.user_id
+		SELECT ` + commentColumns + ` FROM comments c
+		LEFT JOIN users ON users.id = c.user_id
 		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		ORDER BY c.created_at ` + sortDirection(p.Sort) + `, c.id ` + sortDirection(p.Sort) + `
+		LIMIT $2 OFFSET $3;
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, p.Limit, p.Offset)
 	if err != nil {
-		return []Comment{}, err
+		return nil, err
 	}
-
 	defer rows.Close()
 
 	comments := []Comment{}
 	for rows.Next() {
 		var c Comment
-		c.User = User{}
-		err := rows.Scan(&c.ID,
-			&c.PostID,
-			&c.UserID,
-			&c.Content,
-			&c.CreatedAt,
-			&c.User.Username,
-			&c.User.ID,
-		)
-		if err != nil {
-			return []Comment{}, err
+		if err := scanComment(rows, &c); err != nil {
+			return nil, err
 		}
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
 }
 
-func (c CommentStore) Create(ctx context.Context, comment Comment) error {
+// GetTree returns a branch of the comment tree of a post, oldest first on
+// every level. A nil parentID selects the top-level comments of the post,
+// otherwise the replies below parentID.
+func (s CommentStore) GetTree(ctx context.Context, postID types.ID, parentID *types.ID, q CommentTreeQuery) ([]*Comment, error) {
+	// positions are numbered per parent first, so the recursion only has to
+	// join and can cut every branch after q.Replies comments
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at;
+		WITH RECURSIVE ranked AS (
+			SELECT id, parent_id,
+				ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at, id) AS position
+			FROM comments
+			WHERE post_id = $1
+		), tree AS (
+			SELECT id, position, 0 AS level
+			FROM ranked
+			WHERE parent_id IS NOT DISTINCT FROM $2::BIGINT
+				AND position > $3 AND position <= $3 + $4
+			UNION ALL
+			SELECT ranked.id, ranked.position, tree.level + 1
+			FROM ranked
+			JOIN tree ON ranked.parent_id = tree.id
+			WHERE ranked.position <= $5
+		)
+		SELECT ` + commentColumns + ` FROM tree
+		JOIN comments c ON c.id = tree.id
+		LEFT JOIN users ON users.id = c.user_id
+		ORDER BY tree.level, tree.position;
 	`
 
-	err := c.db.
-		QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).
-		Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+	rows, err := s.db.QueryContext(ctx, query, postID, parentID, q.Offset, q.Limit, q.Replies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// rows come level by level in order, so appending keeps siblings sorted
+	roots := []*Comment{}
+	byID := map[types.ID]*Comment{}
+	for rows.Next() {
+		c := &Comment{}
+		if err := scanComment(rows, c); err != nil {
+			return nil, err
+		}
+		byID[c.ID] = c
+
+		parent, ok := byID[derefID(c.ParentID)]
+		if c.ParentID == nil || !ok {
+			roots = append(roots, c)
+			continue
+		}
+		parent.Replies = append(parent.Replies, c)
+	}
+
+	return roots, rows.Err()
+}
+
+func derefID(id *types.ID) types.ID {
+	if id == nil {
+		return 0
+	}
+
+	return *id
+}
+
+func (s CommentStore) GetByID(ctx context.Context, id types.ID) (*Comment, error) {
+	query := `
+		SELECT ` + commentColumns + ` FROM comments c
+		LEFT JOIN users ON users.id = c.user_id
+		WHERE c.id = $1;
+	`
+
+	c := &Comment{}
+	err := scanComment(s.db.QueryRowContext(ctx, query, id), c)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Create adds a comment, or a reply when comment.ParentID is set. Its depth
+// is derived from the parent.
+func (s CommentStore) Create(ctx context.Context, comment *Comment) error {
+	query := `
+		INSERT INTO comments (post_id, parent_id, user_id, content, depth)
+		VALUES ($1, $2, $3, $4, COALESCE((SELECT depth + 1 FROM comments WHERE id = $2), 0))
+		RETURNING id, depth, created_at, updated_at;
+	`
+
+	err := s.db.
+		QueryRowContext(ctx, query, comment.PostID, comment.ParentID, comment.UserID, comment.Content).
+		Scan(&comment.ID, &comment.Depth, &comment.CreatedAt, &comment.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (s CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments SET content = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING updated_at;
+	`
+
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a comment. A comment with replies is blanked and kept as a
+// placeholder instead, so the replies stay in place; placeholders go away
+// once their last reply is deleted.
+func (s CommentStore) Delete(ctx context.Context, id types.ID) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE comments SET content = '', deleted_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+				AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1);
+		`
+
+		res, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows > 0 {
+			return nil
+		}
+
+		var parentID *types.ID
+		query = `DELETE FROM comments WHERE id = $1 AND deleted_at IS NULL RETURNING parent_id;`
+		err = tx.QueryRowContext(ctx, query, id).Scan(&parentID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		return pruneDeletedComments(ctx, tx, parentID)
+	})
+}
+
+// pruneDeletedComments removes placeholders left without replies, walking up
+// from parentID.
+func pruneDeletedComments(ctx context.Context, tx *sql.Tx, parentID *types.ID) error {
+	query := `
+		DELETE FROM comments
+		WHERE id = $1 AND deleted_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1)
+		RETURNING parent_id;
+	`
+
+	for parentID != nil {
+		var next *types.ID
+		err := tx.QueryRowContext(ctx, query, *parentID).Scan(&next)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		parentID = next
+	}
+
+	return nil
+}
+
+func sortDirection(sort string) string {
+	if sort == "desc" {
+		return "DESC"
+	}
+
+	return "ASC"
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+)
+
+// Identity links a user to their account at an external OpenID Connect
+// provider. Subject is the provider's stable id for that account.
+type Identity struct {
+	ID        types.ID `json:"id"`
+	UserID    types.ID `json:"user_id"`
+	Provider  string   `json:"provider"`
+	Subject   string   `json:"subject"`
+	Email     string   `json:"email"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s IdentityStore) Get(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2;
+	`
+
+	identity := &Identity{}
+	err := s.db.QueryRowContext(ctx, query, provider, subject).
+		Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
+
+// Link attaches the identity to an existing user.
+func (s IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, identity)
+	})
+}
+
+func (s IdentityStore) create(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id, created_at;
+	`
+
+	err := tx.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_provider_subject_key"`:
+			return ErrorConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+)
+
+// MFA is a user's TOTP enrollment. Secret is encrypted by the caller before it
+// reaches the store.
+type MFA struct {
+	UserID       types.ID   `json:"user_id"`
+	Secret       []byte     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    string     `json:"created_at"`
+}
+
+func (m MFA) IsEnabled() bool {
+	return m.ConfirmedAt != nil
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+func (s MFAStore) Get(ctx context.Context, userID types.ID) (*MFA, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1;
+	`
+
+	mfa := &MFA{}
+	err := s.db.QueryRowContext(ctx, query, userID).
+		Scan(&mfa.UserID, &mfa.Secret, &mfa.ConfirmedAt, &mfa.LastUsedStep, &mfa.CreatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return mfa, nil
+}
+
+// Enroll stores a new, unconfirmed secret. It replaces an earlier enrollment
+// that was never confirmed and fails with ErrorConflict once MFA is enabled.
+func (s MFAStore) Enroll(ctx context.Context, userID types.ID, secret []byte) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.confirmed_at IS NULL;
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorConflict
+	}
+
+	return nil
+}
+
+// Confirm enables MFA and replaces the user's recovery codes.
+func (s MFAStore) Confirm(ctx context.Context, userID types.ID, step int64, recoveryCodeHashes [][]byte) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $2
+			WHERE user_id = $1 AND confirmed_at IS NULL;
+		`
+
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrorNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2);`
+		for _, hash := range recoveryCodeHashes {
+			if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseStep records that the code of a time step was accepted. A step that is
+// not newer than the last accepted one is a replay and yields ErrorConflict.
+func (s MFAStore) UseStep(ctx context.Context, userID types.ID, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2;`
+
+	res, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode burns a recovery code. Unknown and used codes yield ErrorNotFound.
+func (s MFAStore) UseRecoveryCode(ctx context.Context, userID types.ID, hash []byte) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s MFAStore) Disable(ctx context.Context, userID types.ID) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/lib/pq"
+)
+
+// PostRevision is a post as it was at one version. EditorID is nil when the
+// editor is unknown or their account is gone.
+type PostRevision struct {
+	PostID    types.ID  `json:"post_id"`
+	Version   int       `json:"version"`
+	EditorID  *types.ID `json:"editor_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	CreatedAt string    `json:"created_at"`
+}
+
+// GetRevisions returns one page of the revisions of a post, newest first
+// unless p.Sort is "asc".
+func (s PostStore) GetRevisions(ctx context.Context, postID types.ID, p pkg.PaginationQuery) ([]PostRevision, error) {
+	query := `
+		SELECT post_id, version, editor_id, title, content, tags, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY version ` + sortDirection(p.Sort) + `
+		LIMIT $2 OFFSET $3;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(
+			&rev.PostID,
+			&rev.Version,
+			&rev.EditorID,
+			&rev.Title,
+			&rev.Content,
+			pq.Array(&rev.Tags),
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s PostStore) GetRevision(ctx context.Context, postID types.ID, version int) (*PostRevision, error) {
+	query := `
+		SELECT post_id, version, editor_id, title, content, tags, created_at
+		FROM post_revisions
+		WHERE post_id = $1 AND version = $2;
+	`
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(
+		&rev.PostID,
+		&rev.Version,
+		&rev.EditorID,
+		&rev.Title,
+		&rev.Content,
+		pq.Array(&rev.Tags),
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+func createRevision(ctx context.Context, tx *sql.Tx, post *Post, editorID types.ID) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, editor_id, title, content, tags)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	_, err := tx.ExecContext(ctx, query, post.ID, post.Version, editorID, post.Title, post.Content, pq.Array(post.Tags))
+	return err
+}
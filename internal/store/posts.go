@@ -11,16 +11,18 @@ import (
 )
 
 type Post struct {
-	ID        types.ID  `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    types.ID  `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
-	CreatedAt string    `json:"created_at"`
-	Version   int       `json:"version"`
-	UpdatedAt string    `json:"updated_at"`
+	ID        types.ID   `json:"id"`
+	Content   string     `json:"content"`
+	Title     string     `json:"title"`
+	UserID    types.ID   `json:"user_id"`
+	Tags      []string   `json:"tags"`
+	Comments  []*Comment `json:"comments"`
+	User      User       `json:"user"`
+	CreatedAt string     `json:"created_at"`
+	Version   int        `json:"version"`
+	UpdatedAt string     `json:"updated_at"`
+
+	Reactions ReactionSummary `json:"reactions"`
 }
 
 type PostWithMetaData struct {
@@ -33,21 +35,24 @@ type PostStore struct {
 	db *sql.DB
 }
 
+// Create adds a post and records it as its first revision.
 func (s PostStore) Create(ctx context.Context, post *Post) error {
-	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at;
-	`
-
-	err := s.db.
-		QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).
-		Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
-		return err
-	}
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO posts (content, title, user_id, tags)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at, version;
+		`
+
+		err := tx.
+			QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).
+			Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt, &post.Version)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return createRevision(ctx, tx, post, post.UserID)
+	})
 }
 
 func (s PostStore) GetByID(ctx context.Context, postID types.ID) (*Post, error) {
@@ -65,8 +70,8 @@ func (s PostStore) GetByID(ctx context.Context, postID types.ID) (*Post, error)
 			&post.Content,
 			&post.CreatedAt,
 			&post.UpdatedAt,
-			&post.Version,
 			pq.Array(&post.Tags),
+			&post.Version,
 		)
 	if err != nil {
 		switch {
@@ -100,17 +105,41 @@ func (s PostStore) Delete(ctx context.Context, postID types.ID) error {
 	return nil
 }
 
-func (s PostStore) Update(ctx context.Context, post *Post) error {
-	query := `
-		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version;
-	`
+// Update saves a post if it is still at post.Version and records the result
+// as a new revision made by editorID. When someone else changed the post in
+// the meantime it returns ErrorEditConflict and sets post.Version to the
+// current version.
+func (s PostStore) Update(ctx context.Context, post *Post, editorID types.ID) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE posts
+			SET title = $1, content = $2, tags = $3, version = version + 1, updated_at = NOW()
+			WHERE id = $4 AND version = $5
+			RETURNING version, updated_at;
+		`
+
+		err := tx.
+			QueryRowContext(ctx, query, post.Title, post.Content, pq.Array(post.Tags), post.ID, post.Version).
+			Scan(&post.Version, &post.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return editConflict(ctx, tx, post)
+			default:
+				return err
+			}
+		}
+
+		return createRevision(ctx, tx, post, editorID)
+	})
+}
 
-	err := s.db.
-		QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).
-		Scan(&post.Version)
+// editConflict tells apart an update that found no row because the post is
+// gone from one that lost against a newer version.
+func editConflict(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `SELECT version FROM posts WHERE id = $1;`
+
+	err := tx.QueryRowContext(ctx, query, post.ID).Scan(&post.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -120,12 +149,12 @@ func (s PostStore) Update(ctx context.Context, post *Post) error {
 		}
 	}
 
-	return nil
+	return ErrorEditConflict
 }
 
 func (s PostStore) GetUserFeed(ctx context.Context, userID types.ID, p pkg.PaginationFeedQuery) ([]PostWithMetaData, error) {
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username, COUNT(c.id) AS comments_count
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username, COUNT(c.id) FILTER (WHERE c.deleted_at IS NULL) AS comments_count
 		FROM posts p
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON p.user_id = u.id
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/MohammadBohluli/social-app-go/pkg"
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/lib/pq"
+)
+
+type ReactionTarget string
+
+const (
+	ReactionTargetPost    ReactionTarget = "post"
+	ReactionTargetComment ReactionTarget = "comment"
+)
+
+// reactions lists what users may react with: a like or one of a few emoji.
+var reactions = map[string]bool{
+	"like": true,
+	"❤️":   true,
+	"😂":    true,
+	"😮":    true,
+	"😢":    true,
+	"😡":    true,
+	"👏":    true,
+	"🎉":    true,
+}
+
+func IsReaction(reaction string) bool {
+	return reactions[reaction]
+}
+
+// Reaction is one user's reaction to a post or comment.
+type Reaction struct {
+	UserID    types.ID `json:"user_id"`
+	Username  string   `json:"username"`
+	Reaction  string   `json:"reaction"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// ReactionSummary counts the reactions to a post or comment by kind, and
+// lists which of them came from the user viewing it.
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Viewer []string       `json:"viewer"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add records a reaction. Adding the same reaction twice is a no-op.
+func (s ReactionStore) Add(ctx context.Context, userID types.ID, target ReactionTarget, targetID types.ID, reaction string) error {
+	query := `
+		INSERT INTO reactions (user_id, target_type, target_id, reaction)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING;
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userID, target, targetID, reaction)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s ReactionStore) Remove(ctx context.Context, userID types.ID, target ReactionTarget, targetID types.ID, reaction string) error {
+	query := `
+		DELETE FROM reactions
+		WHERE user_id = $1 AND target_type = $2 AND target_id = $3 AND reaction = $4;
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userID, target, targetID, reaction)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// List returns one page of the reactions to a target, newest first.
+func (s ReactionStore) List(ctx context.Context, target ReactionTarget, targetID types.ID, p pkg.PaginationQuery) ([]Reaction, error) {
+	query := `
+		SELECT r.user_id, users.username, r.reaction, r.created_at
+		FROM reactions r
+		JOIN users ON users.id = r.user_id
+		WHERE r.target_type = $1 AND r.target_id = $2
+		ORDER BY r.created_at ` + sortDirection(p.Sort) + `, r.user_id
+		LIMIT $3 OFFSET $4;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, target, targetID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Reaction{}
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Reaction, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+
+	return list, rows.Err()
+}
+
+// Summaries counts the reactions to many targets of one type in a single
+// query. Every id gets a summary, empty if nobody reacted.
+func (s ReactionStore) Summaries(ctx context.Context, target ReactionTarget, ids []types.ID, viewerID types.ID) (map[types.ID]ReactionSummary, error) {
+	summaries := make(map[types.ID]ReactionSummary, len(ids))
+	for _, id := range ids {
+		summaries[id] = ReactionSummary{Counts: map[string]int{}, Viewer: []string{}}
+	}
+
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	query := `
+		SELECT target_id, reaction, COUNT(*), BOOL_OR(user_id = $3)
+		FROM reactions
+		WHERE target_type = $1 AND target_id = ANY($2)
+		GROUP BY target_id, reaction
+		ORDER BY target_id, reaction;
+	`
+
+	raw := make([]int64, len(ids))
+	for i, id := range ids {
+		raw[i] = int64(id)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, target, pq.Array(raw), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       types.ID
+			reaction string
+			count    int
+			mine     bool
+		)
+		if err := rows.Scan(&id, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+
+		summary, ok := summaries[id]
+		if !ok {
+			continue
+		}
+
+		summary.Counts[reaction] = count
+		if mine {
+			summary.Viewer = append(summary.Viewer, reaction)
+		}
+		summaries[id] = summary
+	}
+
+	return summaries, rows.Err()
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+type RefreshToken struct {
+	ID        types.ID   `json:"id"`
+	UserID    types.ID   `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	Expiry    time.Time  `json:"expiry"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken, hash []byte) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expiry)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+
+	return tx.QueryRowContext(ctx, query, token.UserID, token.FamilyID, hash, token.Expiry).
+		Scan(&token.ID, &token.CreatedAt)
+}
+
+// Rotate revokes the token matching oldHash and stores newHash in the same
+// family. Presenting an already revoked token is treated as theft: the whole
+// family is revoked and ErrRefreshTokenReused is returned.
+func (s RefreshTokenStore) Rotate(ctx context.Context, oldHash, newHash []byte, exp time.Duration) (*RefreshToken, error) {
+	var (
+		next   *RefreshToken
+		reused bool
+	)
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		current, err := s.getByHash(ctx, tx, oldHash)
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			reused = true
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+
+		if current.Expiry.Before(time.Now()) {
+			return ErrorNotFound
+		}
+
+		if err := s.revoke(ctx, tx, current.ID); err != nil {
+			return err
+		}
+
+		next = &RefreshToken{
+			UserID:   current.UserID,
+			FamilyID: current.FamilyID,
+			Expiry:   time.Now().Add(exp),
+		}
+
+		return s.create(ctx, tx, next, newHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return next, nil
+}
+
+// Revoke revokes the token family that the given token belongs to, as long as
+// it is owned by userID.
+func (s RefreshTokenStore) Revoke(ctx context.Context, userID types.ID, hash []byte) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		token, err := s.getByHash(ctx, tx, hash)
+		if err != nil {
+			return err
+		}
+
+		if token.UserID != userID {
+			return ErrorNotFound
+		}
+
+		return s.revokeFamily(ctx, tx, token.FamilyID)
+	})
+}
+
+// RevokeAllForUser revokes every refresh token and session of the user.
+func (s RefreshTokenStore) RevokeAllForUser(ctx context.Context, userID types.ID) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revokeAllForUser(ctx, tx, userID)
+	})
+}
+
+func (s RefreshTokenStore) revokeAllForUser(ctx context.Context, tx *sql.Tx, userID types.ID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s RefreshTokenStore) getByHash(ctx context.Context, tx *sql.Tx, hash []byte) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, expiry, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE;
+	`
+
+	token := &RefreshToken{}
+	err := tx.QueryRowContext(ctx, query, hash).
+		Scan(&token.ID, &token.UserID, &token.FamilyID, &token.Expiry, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func (s RefreshTokenStore) revoke(ctx context.Context, tx *sql.Tx, id types.ID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1;`
+
+	_, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// revokeFamily revokes a token family and the session it belongs to.
+func (s RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, familyID); err != nil {
+		return err
+	}
+
+	query = `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, familyID); err != nil {
+		return err
+	}
+
+	return nil
+}
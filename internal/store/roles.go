@@ -3,15 +3,42 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/lib/pq"
 )
 
+// Permissions checked by the API. The rows themselves are seeded by migration.
+const (
+	PermissionPostsUpdateAny    = "posts.update.any"
+	PermissionPostsDeleteAny    = "posts.delete.any"
+	PermissionCommentsUpdateAny = "comments.update.any"
+	PermissionCommentsDeleteAny = "comments.delete.any"
+	PermissionRolesManage       = "roles.manage"
+	PermissionUsersRoleUpdate   = "users.role.update"
+)
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
 type Role struct {
 	ID          types.ID `json:"id"`
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Level       int      `json:"level"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+func (r *Role) HasPermission(permission string) bool {
+	return slices.Contains(r.Permissions, permission)
+}
+
+type Permission struct {
+	ID          types.ID `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
 }
 
 type RoleStore struct {
@@ -21,12 +48,210 @@ type RoleStore struct {
 func (s RoleStore) GetByName(ctx context.Context, slug string) (*Role, error) {
 	query := `SELECT id, name, description, level FROM roles WHERE name = $1;`
 
+	return s.get(ctx, query, slug)
+}
+
+func (s RoleStore) GetByID(ctx context.Context, id types.ID) (*Role, error) {
+	query := `SELECT id, name, description, level FROM roles WHERE id = $1;`
+
+	return s.get(ctx, query, id)
+}
+
+func (s RoleStore) get(ctx context.Context, query string, arg any) (*Role, error) {
 	role := &Role{}
-	err := s.db.QueryRowContext(ctx, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
+	var description sql.NullString
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(&role.ID, &role.Name, &description, &role.Level)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	role.Description = description.String
 
+	role.Permissions, err = s.permissionsOf(ctx, role.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	return role, nil
 }
+
+func (s RoleStore) permissionsOf(ctx context.Context, roleID types.ID) ([]string, error) {
+	query := `
+		SELECT permissions.name FROM permissions
+		JOIN role_permissions ON (role_permissions.permission_id = permissions.id)
+		WHERE role_permissions.role_id = $1
+		ORDER BY permissions.name;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GetAll lists every role with its permissions, lowest level first.
+func (s RoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	query := `
+		SELECT roles.id, roles.name, roles.description, roles.level,
+			COALESCE(ARRAY_AGG(permissions.name ORDER BY permissions.name) FILTER (WHERE permissions.name IS NOT NULL), '{}')
+		FROM roles
+		LEFT JOIN role_permissions ON (role_permissions.role_id = roles.id)
+		LEFT JOIN permissions ON (permissions.id = role_permissions.permission_id)
+		GROUP BY roles.id
+		ORDER BY roles.level, roles.id;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		var description sql.NullString
+		err := rows.Scan(&role.ID, &role.Name, &description, &role.Level, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		role.Description = description.String
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetPermissions lists every permission that can be granted to a role.
+func (s RoleStore) GetPermissions(ctx context.Context) ([]Permission, error) {
+	query := `SELECT id, name, description FROM permissions ORDER BY name;`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		var description sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &description); err != nil {
+			return nil, err
+		}
+		p.Description = description.String
+
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// Create adds a role with the given permissions. A taken name yields
+// ErrorConflict and an unknown permission ErrUnknownPermission.
+func (s RoleStore) Create(ctx context.Context, role *Role) error {
+	query := `
+		INSERT INTO roles (name, description, level)
+		VALUES ($1, $2, $3)
+		RETURNING id;
+	`
+
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, role.Name, role.Description, role.Level).Scan(&role.ID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+				return ErrorConflict
+			default:
+				return err
+			}
+		}
+
+		return s.setPermissions(ctx, tx, role.ID, role.Permissions)
+	})
+}
+
+// Update changes the name, description and level of a role. Its permissions
+// are replaced too unless role.Permissions is nil.
+func (s RoleStore) Update(ctx context.Context, role *Role) error {
+	query := `UPDATE roles SET name = $1, description = $2, level = $3 WHERE id = $4;`
+
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.Level, role.ID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+				return ErrorConflict
+			default:
+				return err
+			}
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrorNotFound
+		}
+
+		if role.Permissions == nil {
+			return nil
+		}
+
+		return s.setPermissions(ctx, tx, role.ID, role.Permissions)
+	})
+}
+
+func (s RoleStore) setPermissions(ctx context.Context, tx *sql.Tx, roleID types.ID, permissions []string) error {
+	query := `DELETE FROM role_permissions WHERE role_id = $1;`
+	if _, err := tx.ExecContext(ctx, query, roleID); err != nil {
+		return err
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query = `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING;
+	`
+
+	res, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	distinct := slices.Clone(permissions)
+	slices.Sort(distinct)
+	if rows != int64(len(slices.Compact(distinct))) {
+		return fmt.Errorf("%w in %v", ErrUnknownPermission, permissions)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/google/uuid"
+)
+
+// Session is one login of a user on a device. Its id is the family id of the
+// refresh tokens rotated from that login and the sid claim of its access
+// tokens.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     types.ID   `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+// Create starts a session together with its first refresh token.
+func (s SessionStore) Create(ctx context.Context, session *Session, token *RefreshToken, hash []byte) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, last_seen_at;
+	`
+
+	session.ID = uuid.New().String()
+
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP).
+			Scan(&session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return err
+		}
+
+		token.UserID = session.UserID
+		token.FamilyID = session.ID
+
+		return RefreshTokenStore{s.db}.create(ctx, tx, token, hash)
+	})
+}
+
+// GetByID returns a session that has not been revoked.
+func (s SessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at
+		FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL;
+	`
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrorNotFound
+	}
+
+	session := &Session{}
+	err := s.db.QueryRowContext(ctx, query, id).
+		Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.RevokedAt,
+		)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+// GetByUserID lists the sessions of a user that are still active.
+func (s SessionStore) GetByUserID(ctx context.Context, userID types.ID) ([]Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Revoke ends a session of userID and revokes its refresh tokens.
+func (s SessionStore) Revoke(ctx context.Context, userID types.ID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrorNotFound
+	}
+
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;`
+
+		res, err := tx.ExecContext(ctx, query, id, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrorNotFound
+		}
+
+		return RefreshTokenStore{s.db}.revokeFamily(ctx, tx, id)
+	})
+}
+
+// RevokeOthers ends every session of userID except the one with id keepID.
+func (s SessionStore) RevokeOthers(ctx context.Context, userID types.ID, keepID string) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revokeOthers(ctx, tx, userID, keepID)
+	})
+}
+
+func (s SessionStore) revokeOthers(ctx context.Context, tx *sql.Tx, userID types.ID, keepID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id::text <> $2 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, userID, keepID); err != nil {
+		return err
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND family_id::text <> $2 AND revoked_at IS NULL;`
+	if _, err := tx.ExecContext(ctx, query, userID, keepID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Touch records that the session was used. Writes are skipped while the last
+// recorded use is younger than a minute.
+func (s SessionStore) Touch(ctx context.Context, id string) error {
+	query := `
+		UPDATE sessions SET last_seen_at = NOW()
+		WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute';
+	`
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -13,19 +13,28 @@ import (
 var (
 	ErrorNotFound = errors.New("resource not found")
 	ErrorConflict = errors.New("resource already exists")
+	// ErrorEditConflict reports an update based on a stale version of a
+	// resource.
+	ErrorEditConflict = errors.New("edit conflict")
 )
 
 type Storage struct {
 	Posts interface {
 		Create(context.Context, *Post) error
-		Update(context.Context, *Post) error
+		Update(ctx context.Context, post *Post, editorID types.ID) error
 		Delete(context.Context, types.ID) error
 		GetByID(context.Context, types.ID) (*Post, error)
 		GetUserFeed(context.Context, types.ID, pkg.PaginationFeedQuery) ([]PostWithMetaData, error)
+		GetRevisions(ctx context.Context, postID types.ID, p pkg.PaginationQuery) ([]PostRevision, error)
+		GetRevision(ctx context.Context, postID types.ID, version int) (*PostRevision, error)
 	}
 	Comments interface {
-		Create(context.Context, Comment) error
-		GetByPostID(ctx context.Context, postID types.ID) ([]Comment, error)
+		Create(context.Context, *Comment) error
+		Update(context.Context, *Comment) error
+		Delete(context.Context, types.ID) error
+		GetByID(context.Context, types.ID) (*Comment, error)
+		ListByPostID(ctx context.Context, postID types.ID, p pkg.PaginationQuery) ([]Comment, error)
+		GetTree(ctx context.Context, postID types.ID, parentID *types.ID, q CommentTreeQuery) ([]*Comment, error)
 	}
 
 	Users interface {
@@ -33,8 +42,28 @@ type Storage struct {
 		Activate(context.Context, string) error
 		GetByID(context.Context, types.ID) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
+		GetInactiveByEmail(context.Context, string) (*User, error)
 		Delete(context.Context, types.ID) error
-		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
+		CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error
+		CreateAndInvite(ctx context.Context, user *User, exp time.Duration) (*Token, error)
+		ResetPassword(ctx context.Context, token string, passwordHash string) (types.ID, error)
+		ChangePassword(ctx context.Context, userID types.ID, passwordHash string, keepSessionID string) error
+		RequestEmailChange(ctx context.Context, userID types.ID, email string, exp time.Duration) (*Token, error)
+		ConfirmEmailChange(ctx context.Context, token string) (types.ID, error)
+		ScheduleDeletion(ctx context.Context, userID types.ID, deleteAt time.Time) error
+		CancelDeletion(ctx context.Context, userID types.ID) (bool, error)
+		GetDueForDeletion(ctx context.Context, limit int) ([]types.ID, error)
+		Purge(ctx context.Context, userID types.ID) error
+		Export(ctx context.Context, userID types.ID) (*UserExport, error)
+		RecordFailedLogin(ctx context.Context, userID types.ID, maxAttempts int, lockout time.Duration) error
+		ResetFailedLogins(ctx context.Context, userID types.ID) error
+		UpdatePassword(ctx context.Context, userID types.ID, passwordHash string) error
+		SetRole(ctx context.Context, userID, roleID types.ID) error
+	}
+
+	Identities interface {
+		Get(ctx context.Context, provider, subject string) (*Identity, error)
+		Link(ctx context.Context, identity *Identity) error
 	}
 
 	Followers interface {
@@ -44,6 +73,58 @@ type Storage struct {
 
 	Roles interface {
 		GetByName(ctx context.Context, roleName string) (*Role, error)
+		GetByID(ctx context.Context, id types.ID) (*Role, error)
+		GetAll(ctx context.Context) ([]Role, error)
+		GetPermissions(ctx context.Context) ([]Permission, error)
+		Create(ctx context.Context, role *Role) error
+		Update(ctx context.Context, role *Role) error
+	}
+
+	RefreshTokens interface {
+		Rotate(ctx context.Context, oldHash, newHash []byte, exp time.Duration) (*RefreshToken, error)
+		Revoke(ctx context.Context, userID types.ID, hash []byte) error
+		RevokeAllForUser(ctx context.Context, userID types.ID) error
+	}
+
+	Sessions interface {
+		Create(ctx context.Context, session *Session, token *RefreshToken, hash []byte) error
+		GetByID(ctx context.Context, id string) (*Session, error)
+		GetByUserID(ctx context.Context, userID types.ID) ([]Session, error)
+		Revoke(ctx context.Context, userID types.ID, id string) error
+		RevokeOthers(ctx context.Context, userID types.ID, keepID string) error
+		Touch(ctx context.Context, id string) error
+	}
+
+	Tokens interface {
+		New(ctx context.Context, userID types.ID, purpose TokenPurpose, ttl time.Duration) (*Token, error)
+		Replace(ctx context.Context, userID types.ID, purpose TokenPurpose, ttl time.Duration) (*Token, error)
+		Consume(ctx context.Context, plaintext string, purpose TokenPurpose) (types.ID, error)
+		Lookup(ctx context.Context, plaintext string, purpose TokenPurpose) (types.ID, error)
+		DeleteAllForUser(ctx context.Context, userID types.ID, purpose TokenPurpose) error
+	}
+
+	Reactions interface {
+		Add(ctx context.Context, userID types.ID, target ReactionTarget, targetID types.ID, reaction string) error
+		Remove(ctx context.Context, userID types.ID, target ReactionTarget, targetID types.ID, reaction string) error
+		List(ctx context.Context, target ReactionTarget, targetID types.ID, p pkg.PaginationQuery) ([]Reaction, error)
+		Summaries(ctx context.Context, target ReactionTarget, ids []types.ID, viewerID types.ID) (map[types.ID]ReactionSummary, error)
+	}
+
+	MFA interface {
+		Get(ctx context.Context, userID types.ID) (*MFA, error)
+		Enroll(ctx context.Context, userID types.ID, secret []byte) error
+		Confirm(ctx context.Context, userID types.ID, step int64, recoveryCodeHashes [][]byte) error
+		UseStep(ctx context.Context, userID types.ID, step int64) error
+		UseRecoveryCode(ctx context.Context, userID types.ID, hash []byte) error
+		Disable(ctx context.Context, userID types.ID) error
+	}
+
+	APIKeys interface {
+		Create(ctx context.Context, key *APIKey, hash []byte) error
+		GetByHash(ctx context.Context, hash []byte) (*APIKey, error)
+		GetByUserID(ctx context.Context, userID types.ID) ([]APIKey, error)
+		Revoke(ctx context.Context, userID, keyID types.ID) error
+		Touch(ctx context.Context, keyID types.ID) error
 	}
 }
 
@@ -54,6 +135,14 @@ func NewPostgresStorage(db *sql.DB) Storage {
 		Comments:  CommentStore{db},
 		Followers: FollowerStore{db},
 		Roles:     RoleStore{db},
+		Reactions: ReactionStore{db},
+
+		Identities:    IdentityStore{db},
+		RefreshTokens: RefreshTokenStore{db},
+		Sessions:      SessionStore{db},
+		Tokens:        TokenStore{db},
+		MFA:           MFAStore{db},
+		APIKeys:       APIKeyStore{db},
 	}
 }
 
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/MohammadBohluli/social-app-go/internal/auth"
+	"github.com/MohammadBohluli/social-app-go/types"
+)
+
+// TokenPurpose scopes a one-time token, so a token issued for one flow can
+// never be redeemed in another.
+type TokenPurpose string
+
+const (
+	PurposeActivation    TokenPurpose = "activation"
+	PurposePasswordReset TokenPurpose = "password_reset"
+	PurposeEmailChange   TokenPurpose = "email_change"
+	PurposeMagicLink     TokenPurpose = "magic_link"
+)
+
+// Token is a one-time token. Plaintext is only known right after the token
+// is issued; the database keeps its SHA-256 hash.
+type Token struct {
+	Plaintext string       `json:"token"`
+	UserID    types.ID     `json:"user_id"`
+	Purpose   TokenPurpose `json:"purpose"`
+	Expiry    time.Time    `json:"expiry"`
+}
+
+type TokenStore struct {
+	db *sql.DB
+}
+
+func (s TokenStore) New(ctx context.Context, userID types.ID, purpose TokenPurpose, ttl time.Duration) (*Token, error) {
+	var token *Token
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		token, err = s.create(ctx, tx, userID, purpose, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s TokenStore) create(ctx context.Context, tx *sql.Tx, userID types.ID, purpose TokenPurpose, ttl time.Duration) (*Token, error) {
+	query := `INSERT INTO tokens (hash, user_id, purpose, expiry) VALUES ($1, $2, $3, $4);`
+
+	plain, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		Plaintext: plain,
+		UserID:    userID,
+		Purpose:   purpose,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	_, err = tx.ExecContext(ctx, query, hash, token.UserID, token.Purpose, token.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Replace invalidates the user's unused tokens of the purpose and issues a
+// new one in their place.
+func (s TokenStore) Replace(ctx context.Context, userID types.ID, purpose TokenPurpose, ttl time.Duration) (*Token, error) {
+	var token *Token
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteAllForUser(ctx, tx, userID, purpose); err != nil {
+			return err
+		}
+
+		var err error
+		token, err = s.create(ctx, tx, userID, purpose, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Consume redeems a token and returns the user it was issued to. Unknown,
+// expired, already used and wrong-purpose tokens all yield ErrorNotFound.
+func (s TokenStore) Consume(ctx context.Context, plaintext string, purpose TokenPurpose) (types.ID, error) {
+	var userID types.ID
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = s.consume(ctx, tx, plaintext, purpose)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (s TokenStore) consume(ctx context.Context, tx *sql.Tx, plaintext string, purpose TokenPurpose) (types.ID, error) {
+	query := `
+		UPDATE tokens
+		SET used_at = NOW()
+		WHERE hash = $1 AND purpose = $2 AND used_at IS NULL AND expiry > $3
+		RETURNING user_id;
+	`
+
+	var userID types.ID
+	err := tx.QueryRowContext(ctx, query, auth.HashOpaqueToken(plaintext), purpose, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrorNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// Lookup returns the user a token was issued to without redeeming it, so the
+// caller can check a request before Consume. It fails like Consume does.
+func (s TokenStore) Lookup(ctx context.Context, plaintext string, purpose TokenPurpose) (types.ID, error) {
+	query := `
+		SELECT user_id FROM tokens
+		WHERE hash = $1 AND purpose = $2 AND used_at IS NULL AND expiry > $3;
+	`
+
+	var userID types.ID
+	err := s.db.QueryRowContext(ctx, query, auth.HashOpaqueToken(plaintext), purpose, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrorNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// DeleteAllForUser drops the user's unused tokens of the given purpose.
+func (s TokenStore) DeleteAllForUser(ctx context.Context, userID types.ID, purpose TokenPurpose) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		return s.deleteAllForUser(ctx, tx, userID, purpose)
+	})
+}
+
+func (s TokenStore) deleteAllForUser(ctx context.Context, tx *sql.Tx, userID types.ID, purpose TokenPurpose) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;`
+
+	_, err := tx.ExecContext(ctx, query, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -6,8 +6,8 @@ import (
 	"errors"
 	"time"
 
-	"github.com/MohammadBohluli/social-app-go/pkg"
 	"github.com/MohammadBohluli/social-app-go/types"
+	"github.com/lib/pq"
 )
 
 var (
@@ -25,6 +25,14 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    types.ID `json:"role_id"`
 	Role      Role     `json:"role"`
+
+	FailedLoginAttempts int        `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+}
+
+// IsLocked reports whether too many failed logins have temporarily locked the account.
+func (u User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
 }
 
 type UserStore struct {
@@ -38,14 +46,12 @@ func (u UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		RETURNING id, created_at, updated_at
 	`
 
-	hashPassword, _ := pkg.Hash(user.Password)
-
 	role := user.Role.Name
 	if role == "" {
 		role = "user"
 	}
-	err := u.db.
-		QueryRowContext(ctx, query, user.Username, hashPassword, user.Email, role).
+	err := tx.
+		QueryRowContext(ctx, query, user.Username, user.Password, user.Email, role).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		switch {
@@ -64,13 +70,16 @@ func (u UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s UserStore) GetByID(ctx context.Context, userID types.ID) (*User, error) {
 	query := `
-		SELECT users.id, email, username, password, created_at, updated_at, roles.*
+		SELECT users.id, email, username, password, created_at, updated_at, is_active,
+			failed_login_attempts, locked_until,
+			roles.id, roles.name, roles.level, roles.description
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1
 	`
 
 	var user User
+	var description sql.NullString
 	err := s.db.QueryRowContext(ctx, query, userID).
 		Scan(
 			&user.ID,
@@ -79,9 +88,13 @@ func (s UserStore) GetByID(ctx context.Context, userID types.ID) (*User, error)
 			&user.Password,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.IsActive,
+			&user.FailedLoginAttempts,
+			&user.LockedUntil,
+			&user.Role.ID,
 			&user.Role.Name,
 			&user.Role.Level,
-			&user.Role.Description,
+			&description,
 		)
 	if err != nil {
 		switch err {
@@ -92,75 +105,472 @@ func (s UserStore) GetByID(ctx context.Context, userID types.ID) (*User, error)
 		}
 	}
 
+	user.RoleID = user.Role.ID
+	user.Role.Description = description.String
+
 	return &user, nil
 }
 
-func (s UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
-	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+// CreateAndInvite creates an inactive user together with the activation token
+// that is mailed to them.
+func (s UserStore) CreateAndInvite(ctx context.Context, user *User, invitationExp time.Duration) (*Token, error) {
+	var token *Token
 
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
 		}
 
-		if err := s.createAndInvite(ctx, tx, token, invitationExp, user.ID); err != nil {
+		var err error
+		token, err = TokenStore{s.db}.create(ctx, tx, user.ID, PurposeActivation, invitationExp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// CreateWithIdentity creates an active user signed up through an external
+// identity provider, which has already verified the email.
+func (s UserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, user); err != nil {
 			return err
 		}
-		return nil
+
+		query := `UPDATE users SET is_active = true WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, user.ID); err != nil {
+			return err
+		}
+		user.IsActive = true
+
+		identity.UserID = user.ID
+		return IdentityStore{s.db}.create(ctx, tx, identity)
 	})
+}
 
+func (s UserStore) Activate(ctx context.Context, token string) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		tokens := TokenStore{s.db}
+
+		userID, err := tokens.consume(ctx, tx, token, PurposeActivation)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE users SET is_active = true WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		return tokens.deleteAllForUser(ctx, tx, userID, PurposeActivation)
+	})
 }
 
-func (s UserStore) createAndInvite(ctx context.Context, tx *sql.Tx, token string, invitationExp time.Duration, userID types.ID) error {
-	query := `INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3);`
+// ResetPassword redeems a password reset token, stores the new password hash,
+// unlocks the account and revokes every session of the user. It returns
+// the id of the user whose password was reset.
+func (s UserStore) ResetPassword(ctx context.Context, token string, passwordHash string) (types.ID, error) {
+	var userID types.ID
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		tokens := TokenStore{s.db}
 
-	_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(invitationExp))
+		var err error
+		userID, err = tokens.consume(ctx, tx, token, PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE users
+			SET password = $1, failed_login_attempts = 0, locked_until = NULL, updated_at = NOW()
+			WHERE id = $2;
+		`
+		if _, err := tx.ExecContext(ctx, query, passwordHash, userID); err != nil {
+			return err
+		}
+
+		// other reset links for the same account stop working too
+		if err := tokens.deleteAllForUser(ctx, tx, userID, PurposePasswordReset); err != nil {
+			return err
+		}
+
+		return RefreshTokenStore{s.db}.revokeAllForUser(ctx, tx, userID)
+	})
 	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ChangePassword stores a new password hash chosen by a logged in user and
+// revokes every session but keepSessionID, along with pending reset links.
+func (s UserStore) ChangePassword(ctx context.Context, userID types.ID, passwordHash string, keepSessionID string) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2;`
+		if _, err := tx.ExecContext(ctx, query, passwordHash, userID); err != nil {
+			return err
+		}
+
+		tokens := TokenStore{s.db}
+		if err := tokens.deleteAllForUser(ctx, tx, userID, PurposePasswordReset); err != nil {
+			return err
+		}
+
+		return SessionStore{s.db}.revokeOthers(ctx, tx, userID, keepSessionID)
+	})
+}
+
+// RequestEmailChange records email as the pending address of the user and
+// issues the token that confirms it. The current email keeps working until
+// the token is redeemed with ConfirmEmailChange.
+func (s UserStore) RequestEmailChange(ctx context.Context, userID types.ID, email string, exp time.Duration) (*Token, error) {
+	var token *Token
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		var taken bool
+		query := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`
+		if err := tx.QueryRowContext(ctx, query, email).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateEmail
+		}
+
+		query = `UPDATE users SET pending_email = $1 WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, query, email, userID); err != nil {
+			return err
+		}
+
+		tokens := TokenStore{s.db}
+		if err := tokens.deleteAllForUser(ctx, tx, userID, PurposeEmailChange); err != nil {
+			return err
+		}
+
+		var err error
+		token, err = tokens.create(ctx, tx, userID, PurposeEmailChange, exp)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return token, nil
 }
 
-func (s UserStore) Activate(ctx context.Context, token string) error {
+// ConfirmEmailChange redeems an email change token and swaps in the pending
+// email. ErrDuplicateEmail is returned when the address was taken in the
+// meantime.
+func (s UserStore) ConfirmEmailChange(ctx context.Context, token string) (types.ID, error) {
+	var userID types.ID
+
+	err := withTX(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = TokenStore{s.db}.consume(ctx, tx, token, PurposeEmailChange)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE users
+			SET email = pending_email, pending_email = NULL, updated_at = NOW()
+			WHERE id = $1 AND pending_email IS NOT NULL;
+		`
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrorNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ScheduleDeletion marks the account for deletion at deleteAt, logs it out
+// everywhere and revokes its API keys. Logging in again before then cancels
+// the deletion.
+func (s UserStore) ScheduleDeletion(ctx context.Context, userID types.ID, deleteAt time.Time) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, query, deleteAt, userID); err != nil {
+			return err
+		}
+
+		if err := (RefreshTokenStore{s.db}).revokeAllForUser(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		return APIKeyStore{s.db}.revokeAllForUser(ctx, tx, userID)
+	})
+}
+
+// CancelDeletion clears a scheduled deletion and reports whether there was one.
+func (s UserStore) CancelDeletion(ctx context.Context, userID types.ID) (bool, error) {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// GetDueForDeletion returns up to limit users whose grace period has ended.
+func (s UserStore) GetDueForDeletion(ctx context.Context, limit int) ([]types.ID, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at <= NOW()
+		ORDER BY deletion_scheduled_at
+		LIMIT $1;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []types.ID
+	for rows.Next() {
+		var id types.ID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Purge erases a user whose deletion is due, together with their comments and
+// the comments on their posts. Their comments with replies are blanked into
+// placeholders instead, so the replies survive. Posts, follows, sessions and
+// tokens go with the user row. ErrorNotFound is returned if the deletion was
+// cancelled meanwhile.
+func (s UserStore) Purge(ctx context.Context, userID types.ID) error {
 	return withTX(s.db, ctx, func(tx *sql.Tx) error {
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+		query := `SELECT id FROM users WHERE id = $1 AND deletion_scheduled_at <= NOW() FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&userID); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			UPDATE comments c SET content = '', deleted_at = NOW()
+			WHERE c.user_id = $1 AND c.deleted_at IS NULL
+				AND c.post_id NOT IN (SELECT id FROM posts WHERE user_id = $1)
+				AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		// comments have no foreign keys to users or posts, so they don't cascade
+		query = `
+			DELETE FROM comments
+			WHERE (user_id = $1 AND deleted_at IS NULL) OR post_id IN (SELECT id FROM posts WHERE user_id = $1)
+			RETURNING parent_id
+		`
+		rows, err := tx.QueryContext(ctx, query, userID)
 		if err != nil {
 			return err
 		}
 
-		user.IsActive = true
-		if err := s.update(ctx, tx, user); err != nil {
+		var parentIDs []*types.ID
+		for rows.Next() {
+			var parentID *types.ID
+			if err := rows.Scan(&parentID); err != nil {
+				rows.Close()
+				return err
+			}
+			parentIDs = append(parentIDs, parentID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
 			return err
 		}
 
-		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+		// placeholders whose replies were all the user's have nothing left to
+		// hold up; parents deleted along with a post are simply not found
+		for _, parentID := range parentIDs {
+			if err := pruneDeletedComments(ctx, tx, parentID); err != nil {
+				return err
+			}
+		}
+
+		// placeholders left behind must not point back to the erased account
+		query = `UPDATE comments SET user_id = 0 WHERE user_id = $1`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
 			return err
 		}
-		return nil
+
+		return s.delete(ctx, tx, userID)
 	})
 }
 
-func (s UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+// UserExport is everything we store about a user, for data export requests.
+type UserExport struct {
+	Profile    *User           `json:"profile"`
+	Posts      []ExportPost    `json:"posts"`
+	Comments   []ExportComment `json:"comments"`
+	Followers  []ExportFollow  `json:"followers"`
+	Following  []ExportFollow  `json:"following"`
+	ExportedAt time.Time       `json:"exported_at"`
+}
+
+type ExportPost struct {
+	ID        types.ID `json:"id"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+type ExportComment struct {
+	ID        types.ID `json:"id"`
+	PostID    types.ID `json:"post_id"`
+	Content   string   `json:"content"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type ExportFollow struct {
+	UserID   types.ID `json:"user_id"`
+	Username string   `json:"username"`
+	Since    string   `json:"since"`
+}
+
+func (s UserStore) Export(ctx context.Context, userID types.ID) (*UserExport, error) {
+	profile, err := s.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &UserExport{
+		Profile:    profile,
+		Posts:      []ExportPost{},
+		Comments:   []ExportComment{},
+		Followers:  []ExportFollow{},
+		Following:  []ExportFollow{},
+		ExportedAt: time.Now(),
+	}
+
+	err = withTX(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, title, content, tags, created_at, updated_at
+			FROM posts WHERE user_id = $1 ORDER BY created_at
+		`
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var p ExportPost
+			if err := rows.Scan(&p.ID, &p.Title, &p.Content, pq.Array(&p.Tags), &p.CreatedAt, &p.UpdatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			export.Posts = append(export.Posts, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query = `
+			SELECT id, post_id, content, created_at
+			FROM comments WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at
+		`
+		rows, err = tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var c ExportComment
+			if err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			export.Comments = append(export.Comments, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if export.Followers, err = s.exportFollows(ctx, tx, "f.follower_id", "f.user_id", userID); err != nil {
+			return err
+		}
+
+		export.Following, err = s.exportFollows(ctx, tx, "f.user_id", "f.follower_id", userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// exportFollows lists the users on the other side of the user's follow edges.
+// other and self name the followers columns; they are never user input.
+func (s UserStore) exportFollows(ctx context.Context, tx *sql.Tx, other, self string, userID types.ID) ([]ExportFollow, error) {
 	query := `
-    	SELECT u.id, u.username, u.email, u.created_at, u.is_active
-    	FROM users u
-    	JOIN user_invitations ui ON u.id = ui.user_id
-    	WHERE ui.token = $1 AND ui.expiry > $2
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = ` + other + `
+		WHERE ` + self + ` = $1
+		ORDER BY f.created_at
 	`
 
-	user := &User{}
-	err := tx.QueryRowContext(ctx, query, token, time.Now()).
-		Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+	rows, err := tx.QueryContext(ctx, query, userID)
 	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			return nil, ErrorNotFound
-		default:
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []ExportFollow{}
+	for rows.Next() {
+		var f ExportFollow
+		if err := rows.Scan(&f.UserID, &f.Username, &f.Since); err != nil {
 			return nil, err
 		}
+		follows = append(follows, f)
 	}
 
-	return user, nil
+	return follows, rows.Err()
 }
 
 func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
@@ -174,8 +584,14 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	return nil
 }
 
-func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID types.ID) error {
-	query := "DELETE FROM user_invitations WHERE user_id = $1"
+func (s UserStore) Delete(ctx context.Context, userID types.ID) error {
+	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+		return s.delete(ctx, tx, userID)
+	})
+}
+
+func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID types.ID) error {
+	query := "DELETE FROM users WHERE id = $1"
 
 	_, err := tx.ExecContext(ctx, query, userID)
 	if err != nil {
@@ -185,25 +601,62 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 	return nil
 }
 
-func (s UserStore) Delete(ctx context.Context, userID types.ID) error {
-	return withTX(s.db, ctx, func(tx *sql.Tx) error {
+func (s UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT users.id, username, email, password, created_at, is_active, failed_login_attempts, locked_until,
+			roles.id, roles.name, roles.level
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE email = $1 AND is_active = true;
+	`
 
-		if err := s.delete(ctx, tx, userID); err != nil {
-			return err
+	user := &User{}
+	err := s.db.QueryRowContext(ctx, query, email).
+		Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Password,
+			&user.CreatedAt,
+			&user.IsActive,
+			&user.FailedLoginAttempts,
+			&user.LockedUntil,
+			&user.Role.ID,
+			&user.Role.Name,
+			&user.Role.Level,
+		)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
 		}
+	}
 
-		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
-			return err
-		}
+	user.RoleID = user.Role.ID
 
-		return nil
-	})
+	return user, nil
 }
 
-func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID types.ID) error {
-	query := "DELETE FROM users WHERE id = $1"
+// RecordFailedLogin counts a failed login. When the count reaches maxAttempts
+// the account is locked for lockout and the counter starts over.
+func (s UserStore) RecordFailedLogin(ctx context.Context, userID types.ID, maxAttempts int, lockout time.Duration) error {
+	query := `
+		UPDATE users
+		SET
+			failed_login_attempts = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN 0
+				ELSE failed_login_attempts + 1
+			END,
+			locked_until = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN $3
+				ELSE locked_until
+			END
+		WHERE id = $1;
+	`
 
-	_, err := tx.ExecContext(ctx, query, userID)
+	_, err := s.db.ExecContext(ctx, query, userID, maxAttempts, time.Now().Add(lockout))
 	if err != nil {
 		return err
 	}
@@ -211,15 +664,61 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID types.ID) err
 	return nil
 }
 
-func (s UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+func (s UserStore) ResetFailedLogins(ctx context.Context, userID types.ID) error {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1;`
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the stored password hash without touching sessions,
+// for upgrading a hash the user has just proven knowledge of.
+func (s UserStore) UpdatePassword(ctx context.Context, userID types.ID, passwordHash string) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2;`
+
+	_, err := s.db.ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetRole moves the user to another role.
+func (s UserStore) SetRole(ctx context.Context, userID, roleID types.ID) error {
+	query := `UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2;`
+
+	res, err := s.db.ExecContext(ctx, query, roleID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// GetInactiveByEmail finds a user that has registered but not activated yet.
+func (s UserStore) GetInactiveByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at FROM users
-		WHERE email = $1 AND is_active = true;
+		SELECT id, username, email, created_at, is_active FROM users
+		WHERE email = $1 AND is_active = false;
 	`
 
 	user := &User{}
 	err := s.db.QueryRowContext(ctx, query, email).
-		Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
+		Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
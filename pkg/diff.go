@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around every change.
+const diffContext = 3
+
+// MaxDiffLines bounds the lines of both texts together, as the time to diff
+// grows with their count times the number of changes.
+const MaxDiffLines = 10000
+
+var ErrDiffTooLarge = fmt.Errorf("texts have more than %d lines to compare", MaxDiffLines)
+
+type diffOp struct {
+	kind byte // ' ' kept, '-' removed, '+' added
+	line string
+}
+
+// UnifiedDiff compares a and b line by line and renders the changes in the
+// unified format of diff -u, labelled fromName and toName. It returns an
+// empty string when both are equal, and ErrDiffTooLarge when they have more
+// than MaxDiffLines lines together.
+func UnifiedDiff(fromName, toName, a, b string) (string, error) {
+	aLines, bLines := splitLines(a), splitLines(b)
+	if len(aLines)+len(bLines) > MaxDiffLines {
+		return "", ErrDiffTooLarge
+	}
+
+	ops := diffLines(aLines, bLines)
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		first := nextChange(ops, start)
+		if first < 0 {
+			break
+		}
+
+		// a hunk grows as long as the next change is close enough for the
+		// context around both to touch
+		last := first
+		for {
+			next := nextChange(ops, last+1)
+			if next < 0 || next-last-1 > 2*diffContext {
+				break
+			}
+			last = next
+		}
+
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops, from, to)
+
+		start = to
+	}
+
+	return out.String(), nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func nextChange(ops []diffOp, from int) int {
+	for i := from; i < len(ops); i++ {
+		if ops[i].kind != ' ' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp, from, to int) {
+	aLine, bLine := 1, 1
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+
+	// an empty range names the line before it, as diff -u does
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, op := range ops[from:to] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// diffLines finds a shortest edit script from a to b with the linear space
+// variant of Myers' algorithm, so memory grows with the input rather than
+// with the square of the edit distance.
+func diffLines(a, b []string) []diffOp {
+	size := (len(a)+len(b)+1)/2 + 1
+	d := differ{
+		a:      a,
+		b:      b,
+		offset: size,
+		vf:     make([]int, 2*size+1),
+		vb:     make([]int, 2*size+1),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	return d.ops
+}
+
+type differ struct {
+	a, b []string
+	ops  []diffOp
+
+	// furthest reaching x per diagonal of the forward and the backward
+	// search, shifted by offset since diagonals go negative
+	offset int
+	vf, vb []int
+}
+
+// compare appends the edit script from a[aLo:aHi] to b[bLo:bHi]. It splits the
+// ranges at the middle snake of a shortest script and recurses into both halves.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, diffOp{' ', d.a[aLo]})
+		aLo++
+		bLo++
+	}
+
+	suffix := 0
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	switch {
+	case aLo == aHi:
+		for _, line := range d.b[bLo:bHi] {
+			d.ops = append(d.ops, diffOp{'+', line})
+		}
+	case bLo == bHi:
+		for _, line := range d.a[aLo:aHi] {
+			d.ops = append(d.ops, diffOp{'-', line})
+		}
+	default:
+		// both ends differ, so the script has at least two edits and each
+		// half is left with fewer
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for _, line := range d.a[x:u] {
+			d.ops = append(d.ops, diffOp{' ', line})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for _, line := range d.a[aHi : aHi+suffix] {
+		d.ops = append(d.ops, diffOp{' ', line})
+	}
+}
+
+// middleSnake searches from both corners of the ranges at once until the paths
+// meet, and returns the snake, from (x, y) to (u, v), where they do. The
+// backward search counts x and y from the end of the ranges.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	vf, vb, off := d.vf, d.vb, d.offset
+
+	vf[off+1], vb[off+1] = 0, 0
+	for step := 0; step <= (n+m+1)/2; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+
+			// the backward search of the previous step ran along this
+			// diagonal as delta-k
+			if odd && delta-k >= -(step-1) && delta-k <= step-1 && x >= n-vb[off+delta-k] {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+
+			if !odd && delta-k >= -step && delta-k <= step && vf[off+delta-k] >= n-x {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	// the searches always meet within (n+m+1)/2 steps
+	panic("diff: middle snake not found")
+}
@@ -0,0 +1,161 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1 to n with the given lines replaced.
+func numbered(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replace[i]; ok {
+			b.WriteString(line + "\n")
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	return b.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal texts",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "a missing trailing newline is no change",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- x\n+++ y\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "to empty",
+			a:    "a\nb\n",
+			b:    "",
+			want: "--- x\n+++ y\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "change at the start",
+			a:    numbered(8, nil),
+			b:    numbered(8, map[int]string{1: "x"}),
+			want: "--- x\n+++ y\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n",
+		},
+		{
+			name: "change at the end",
+			a:    numbered(8, nil),
+			b:    numbered(8, map[int]string{8: "x"}),
+			want: "--- x\n+++ y\n@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+x\n",
+		},
+		{
+			name: "changes within twice the context share a hunk",
+			a:    numbered(12, nil),
+			b:    numbered(12, map[int]string{2: "x", 9: "y"}),
+			want: "--- x\n+++ y\n@@ -1,12 +1,12 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+y\n 10\n 11\n 12\n",
+		},
+		{
+			name: "changes further apart get a hunk each",
+			a:    numbered(13, nil),
+			b:    numbered(13, map[int]string{2: "x", 10: "y"}),
+			want: "--- x\n+++ y\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -7,7 +7,7 @@\n 7\n 8\n 9\n-10\n+y\n 11\n 12\n 13\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnifiedDiff("x", "y", tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	half := strings.Repeat("a\n", MaxDiffLines/2)
+
+	if _, err := UnifiedDiff("x", "y", half, half); err != nil {
+		t.Fatalf("at the limit: %v", err)
+	}
+
+	if _, err := UnifiedDiff("x", "y", half, half+"b\n"); !errors.Is(err, ErrDiffTooLarge) {
+		t.Fatalf("err = %v, want %v", err, ErrDiffTooLarge)
+	}
+}
+
+// TestDiffLines checks on random texts that the script turns a into b and is
+// as short as the one found by the longest common subsequence.
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, r.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(1+r.Intn(6))))
+		}
+		return lines
+	}
+
+	for i := 0; i < 5000; i++ {
+		a, b := text(), text()
+
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("script for %q -> %q does not reproduce both texts", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("script for %q -> %q has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -32,6 +32,29 @@ func ConflictErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	WriteJsonError(w, http.StatusConflict, err.Error())
 }
 
+// EditConflictResponse reports an update that lost against a concurrent one,
+// along with the version it has to be based on.
+func EditConflictResponse(w http.ResponseWriter, r *http.Request, version int) {
+	log.Printf("❌edit conflict: %s path: %s current version: %d", r.Method, r.URL.Path, version)
+	writeVersionError(w, http.StatusConflict, "edit conflict, the resource was changed in the meantime", version)
+}
+
+// PreconditionFailedResponse reports an If-Match header that does not match
+// the current version.
+func PreconditionFailedResponse(w http.ResponseWriter, r *http.Request, version int) {
+	log.Printf("❌precondition failed: %s path: %s current version: %d", r.Method, r.URL.Path, version)
+	writeVersionError(w, http.StatusPreconditionFailed, "precondition failed, the resource was changed in the meantime", version)
+}
+
+func writeVersionError(w http.ResponseWriter, statusCode int, message string, version int) {
+	type envelope struct {
+		Error   string `json:"error"`
+		Version int    `json:"version"`
+	}
+
+	WriteJson(w, statusCode, envelope{Error: message, Version: version})
+}
+
 func UnAuthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("unauthorized error: %s path: %s error: %s", r.Method, r.URL.Path, err)
 	WriteJsonError(w, http.StatusUnauthorized, "unauthorized")
@@ -44,9 +67,21 @@ func UnAuthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err
 }
 
 func RateLimitExceededErrorResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
-	log.Printf("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
+	log.Printf("rate limit exceeded: %s path: %s", r.Method, r.URL.Path)
 
 	w.Header().Set("Retry-After", retryAfter)
 
 	WriteJsonError(w, http.StatusUnauthorized, "rate limit exceeded, retry after: ")
 }
+
+// FailedValidationResponse reports every invalid field with the problems found in it.
+func FailedValidationResponse(w http.ResponseWriter, r *http.Request, fields map[string][]string) {
+	log.Printf("❌validation error: %s path: %s fields: %v", r.Method, r.URL.Path, fields)
+
+	type envelope struct {
+		Error  string              `json:"error"`
+		Fields map[string][]string `json:"fields"`
+	}
+
+	WriteJson(w, http.StatusUnprocessableEntity, envelope{Error: "validation failed", Fields: fields})
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -76,3 +77,45 @@ func parseTime(s string) string {
 
 	return t.Format(time.DateTime)
 }
+
+// PaginationQuery pages through a plain list. Unlike the feed query, invalid
+// values are reported instead of being ignored.
+type PaginationQuery struct {
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Sort   string `json:"sort"`
+}
+
+const maxPageLimit = 100
+
+func (p PaginationQuery) Parse(r *http.Request) (PaginationQuery, error) {
+	query := r.URL.Query()
+
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxPageLimit {
+			return p, errors.New("limit must be a number between 1 and 100")
+		}
+
+		p.Limit = l
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil || o < 0 {
+			return p, errors.New("offset must not be negative")
+		}
+
+		p.Offset = o
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if sort != "asc" && sort != "desc" {
+			return p, errors.New("sort must be asc or desc")
+		}
+
+		p.Sort = sort
+	}
+
+	return p, nil
+}